@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"greenlight.sparkyvxcx.co/internal/data"
+	"greenlight.sparkyvxcx.co/internal/validator"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// The deleteCurrentUserHandler() schedules the account of the logged in user for deletion, once they've
+// confirmed their password. The account is purged after the grace period, and until then it can be
+// restored by logging in and cancelling the deletion. All sessions and API keys are revoked straight away.
+func (app *application) deleteCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if v.Check(input.Password != "", "password", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !match {
+		v.AddError("password", "is incorrect")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	scheduledAt := time.Now().Add(app.config.accounts.deletionGrace).Truncate(time.Second)
+
+	err = app.models.Users.ScheduleDeletion(user.ID, scheduledAt)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllSessionsForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.APIKeys.DeleteAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.logSecurityEvent(r, "account_deletion_scheduled", user)
+
+	app.background(func() {
+		data := map[string]interface{}{
+			"userName":    user.Name,
+			"scheduledAt": scheduledAt.Format(time.RFC1123),
+		}
+
+		err := app.mailer.Send(user.Email, "account_deletion.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	message := fmt.Sprintf("your account will be deleted on %s, to cancel the deletion log in before then and send a DELETE /v1/users/me/deletion request", scheduledAt.Format(time.RFC3339))
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"message": message}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) cancelAccountDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	err := app.models.Users.CancelDeletion(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.logSecurityEvent(r, "account_deletion_cancelled", user)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "the deletion of your account has been cancelled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The exportCurrentUserHandler() starts building an archive of the personal data held about the logged in
+// user. The archive is built in the background, and a link to download it is emailed to the user.
+func (app *application) exportCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Every export ends in an email, so they share the per-address email limit.
+	if !app.emailLimiter.allow(user.Email) {
+		app.rateLimitExceededResponse(w, r)
+		return
+	}
+
+	app.background(func() {
+		archive, err := app.buildExport(user)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			return
+		}
+
+		token, err := app.models.Exports.Insert(user.ID, archive, app.config.exports.ttl)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			return
+		}
+
+		data := map[string]interface{}{
+			"userName":    user.Name,
+			"downloadURL": fmt.Sprintf("%s/v1/exports/%s", app.config.baseURL, token.Plaintext),
+			"expiry":      token.Expiry.Format(time.RFC1123),
+		}
+
+		err = app.mailer.Send(user.Email, "data_export.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"message": "your data export is being prepared, an email will be sent to you with a link to download it"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The downloadExportHandler() serves a personal data export. The token in the URL is the only credential,
+// so that the link in the email works on its own.
+func (app *application) downloadExportHandler(w http.ResponseWriter, r *http.Request) {
+	token := httprouter.ParamsFromContext(r.Context()).ByName("token")
+
+	v := validator.New()
+
+	if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	archive, err := app.models.Exports.GetForToken(token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="greenlight-export.json"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(archive)
+}
+
+// The buildExport() helper collects the personal data held about a user into a JSON archive.
+func (app *application) buildExport(user *data.User) ([]byte, error) {
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := app.models.Tokens.GetSessionsForUser(user.ID, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	apiKeys, err := app.models.APIKeys.GetAllForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	collections, err := app.models.Collections.GetAllForOwner(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	movies, err := app.models.Movies.GetAllCreatedBy(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	collaborations, err := app.models.MovieCollaborators.GetMoviesForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := app.models.Roles.GetAllForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := app.models.Groups.GetAllForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The other members of a group are their own data, so only the group itself is exported.
+	groupMemberships := []envelope{}
+	for _, group := range groups {
+		groupMemberships = append(groupMemberships, envelope{"id": group.ID, "name": group.Name, "roles": group.Roles})
+	}
+
+	events, err := app.models.Audit.GetAllForTarget(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Likewise the administrator who acted, and where from, isn't the user's data.
+	auditEvents := []envelope{}
+	for _, event := range events {
+		auditEvents = append(auditEvents, envelope{"created_at": event.CreatedAt, "action": event.Action, "details": event.Details})
+	}
+
+	archive := envelope{
+		"exported_at":          time.Now().UTC(),
+		"user":                 user,
+		"permissions":          permissions,
+		"roles":                roles,
+		"groups":               groupMemberships,
+		"sessions":             sessions,
+		"api_keys":             apiKeys,
+		"collections":          collections,
+		"movies":               movies,
+		"movie_collaborations": collaborations,
+		"audit_events":         auditEvents,
+	}
+
+	return json.MarshalIndent(archive, "", "\t")
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"greenlight.sparkyvxcx.co/internal/data"
+	"greenlight.sparkyvxcx.co/internal/validator"
+
+	"github.com/tomasen/realip"
+)
+
+func (app *application) adminListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Search    string
+		Activated *bool
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Search = app.readString(qs, "q", "")
+	input.Activated = app.readBool(qs, "activated", v)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortWhitelist = []string{"id", "name", "email", "created_at", "-id", "-name", "-email", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	users, metadata, err := app.models.Users.GetAll(input.Search, input.Activated, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"users": users, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) adminShowUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if permissions == nil {
+		permissions = data.Permissions{}
+	}
+
+	roles, err := app.models.Roles.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	failures, err := app.models.LoginFailures.Get(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user, "roles": roles, "permissions": permissions, "locked_until": failures.LockedUntil}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The adminUpdateUserActivatedHandler() activates or deactivates a user. Deactivated users can still log
+// in, but every endpoint which needs an activated account turns them away.
+func (app *application) adminUpdateUserActivatedHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Activated *bool `json:"activated"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.Activated != nil, "activated", "must be provided")
+	if input.Activated != nil && !*input.Activated {
+		v.Check(user.ID != app.contextGetUser(r).ID, "activated", "you can't deactivate yourself")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user.Activated = *input.Activated
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	action := "user.deactivate"
+	if user.Activated {
+		action = "user.activate"
+	}
+
+	err = app.audit(r, action, user, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) adminGrantPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	app.adminChangePermissions(w, r, true)
+}
+
+func (app *application) adminRevokePermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	app.adminChangePermissions(w, r, false)
+}
+
+// The adminChangePermissions() helper grants or revokes the permissions listed in the request body, and
+// responds with the user's permissions afterwards.
+func (app *application) adminChangePermissions(w http.ResponseWriter, r *http.Request, grant bool) {
+	user, ok := app.readTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Permissions []string `json:"permissions"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	known, err := app.models.Permissions.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(len(input.Permissions) >= 1, "permissions", "must contain at least 1 permission")
+	for _, code := range input.Permissions {
+		if !validator.In(code, known...) {
+			v.AddError("permissions", fmt.Sprintf("%q is not a known permission", code))
+			break
+		}
+	}
+
+	// Administrators can't lock themselves out of the admin API.
+	if !grant && user.ID == app.contextGetUser(r).ID && data.Permissions(input.Permissions).Include("users:admin") {
+		v.AddError("permissions", "you can't revoke your own users:admin permission")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	action := "permissions.revoke"
+	if grant {
+		action = "permissions.grant"
+		err = app.models.Permissions.AddForUser(user.ID, input.Permissions...)
+	} else {
+		err = app.models.Permissions.RemoveForUser(user.ID, input.Permissions...)
+		if err == nil {
+			// Signed authentication tokens carry the permissions the user held when they were issued.
+			err = app.models.Users.RevokeSignedTokens(user.ID)
+		}
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.audit(r, action, user, map[string]interface{}{"permissions": input.Permissions})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if permissions == nil {
+		permissions = data.Permissions{}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"permissions": permissions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The adminLogoutUserHandler() revokes every session of a user, including the signed authentication
+// tokens already issued.
+func (app *application) adminLogoutUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Tokens.DeleteAllSessionsForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Users.RevokeSignedTokens(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.audit(r, "user.logout", user, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": fmt.Sprintf("all sessions of user %d successfully revoked", user.ID)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The adminResetUserPasswordHandler() emails a user a password reset token, like if they had asked for one.
+func (app *application) adminResetUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.audit(r, "user.password_reset", user, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.background(func() {
+		err := app.sendPasswordResetEmail(user)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"message": fmt.Sprintf("a password reset email will be sent to user %d", user.ID)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The adminUnlockUserHandler() lets an administrator unlock an account locked after failed logins.
+func (app *application) adminUnlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.unlockUser(r, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.audit(r, "user.unlock", user, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": fmt.Sprintf("user %d successfully unlocked", user.ID)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) adminListAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		UserID int
+		data.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.UserID = app.readInt(qs, "user_id", 0, v)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "-id")
+	input.Filters.SortWhitelist = []string{"id", "-id"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	events, metadata, err := app.models.Audit.GetAll(int64(input.UserID), input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"audit_events": events, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The readTargetUser() helper fetches the user named by the "id" URL parameter of an admin endpoint. If
+// the user can't be returned, a response has already been sent and ok is false.
+func (app *application) readTargetUser(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	user, err := app.models.Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return user, true
+}
+
+// The audit() helper records an administrative action taken by the user in the request context against
+// the target user. The target is nil for actions which don't concern a single user, such as editing a group.
+func (app *application) audit(r *http.Request, action string, target *data.User, details map[string]interface{}) error {
+	actor := app.contextGetUser(r)
+
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+
+	event := &data.AuditEvent{
+		ActorID: &actor.ID,
+		Action:  action,
+		Details: details,
+		IP:      realip.FromRequest(r),
+	}
+
+	if target != nil {
+		event.TargetUserID = &target.ID
+	}
+
+	return app.models.Audit.Insert(event)
+}
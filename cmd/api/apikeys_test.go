@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"greenlight.sparkyvxcx.co/internal/assert"
+	"greenlight.sparkyvxcx.co/internal/cache"
+	"greenlight.sparkyvxcx.co/internal/data"
+	"greenlight.sparkyvxcx.co/internal/jsonlog"
+)
+
+// stubAPIKeyModel accepts any API key, as a key of user 1 scoped to movies:read.
+type stubAPIKeyModel struct {
+	data.APIKeyModel
+}
+
+func (m stubAPIKeyModel) GetForKey(plaintext string) (*data.APIKey, error) {
+	return &data.APIKey{ID: 1, UserID: 1, Scopes: data.Permissions{"movies:read"}}, nil
+}
+
+func (m stubAPIKeyModel) Touch(id int64) error {
+	return nil
+}
+
+// stubUserModel returns an activated user for any ID, with the given token generation.
+type stubUserModel struct {
+	data.UserModel
+	tokenGeneration int32
+}
+
+func (m stubUserModel) Get(id int64) (*data.User, error) {
+	return &data.User{ID: id, Activated: true}, nil
+}
+
+func (m stubUserModel) GetTokenGeneration(userID int64) (int32, error) {
+	return m.tokenGeneration, nil
+}
+
+func TestAPIKeyNotAllowed(t *testing.T) {
+	app := &application{
+		logger:     jsonlog.New(io.Discard, jsonlog.LevelInfo),
+		touchCache: cache.New[string, struct{}](time.Minute, 0),
+		models: data.Models{
+			APIKeys: stubAPIKeyModel{},
+			Users:   stubUserModel{},
+		},
+	}
+
+	handler := app.handlers()
+
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/v1/users/me/sessions"},
+		{http.MethodDelete, "/v1/users/me/sessions"},
+		{http.MethodDelete, "/v1/users/me/sessions/1"},
+		{http.MethodDelete, "/v1/tokens/authentication"},
+		{http.MethodGet, "/v1/users/me/api-keys"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.Header.Set("Authorization", "Bearer "+data.APIKeyPrefix+"TESTKEY")
+
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, w.Code, http.StatusForbidden)
+			assert.Contains(t, w.Body.String(), "can't be accessed with an API key")
+		})
+	}
+}
+
+type missingUserModel struct {
+	data.UserModel
+}
+
+func (m missingUserModel) Get(id int64) (*data.User, error) {
+	return nil, data.ErrRecordNotFound
+}
+
+func TestAPIKeyOfMissingUser(t *testing.T) {
+	app := &application{
+		logger: jsonlog.New(io.Discard, jsonlog.LevelInfo),
+		models: data.Models{
+			APIKeys: stubAPIKeyModel{},
+			Users:   missingUserModel{},
+		},
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+	r.Header.Set("Authorization", "Bearer "+data.APIKeyPrefix+"TESTKEY")
+
+	app.authenticate(http.NotFoundHandler()).ServeHTTP(w, r)
+
+	assert.Equal(t, w.Code, http.StatusUnauthorized)
+}
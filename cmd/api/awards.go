@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+	"greenlight.sparkyvxcx.co/internal/data"
+	"greenlight.sparkyvxcx.co/internal/validator"
+)
+
+func (app *application) listMovieAwardsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Make sure the movie exists, so that an unknown movie is a 404 rather than an empty list.
+	_, err = app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	awards, err := app.models.Awards.GetAllForMovie(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"awards": awards}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listCeremonyAwardsHandler(w http.ResponseWriter, r *http.Request) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	ceremony := params.ByName("ceremony")
+
+	year, err := strconv.ParseInt(params.ByName("year"), 10, 32)
+	if err != nil || year < 1 {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateCeremony(v, ceremony); !v.Valid() {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	awards, err := app.models.Awards.GetAllForCeremony(ceremony, int32(year))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"awards": awards}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) importAwardsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Awards []struct {
+			Ceremony string `json:"ceremony"`
+			Year     int32  `json:"year"`
+			Category string `json:"category"`
+			Nominee  string `json:"nominee"`
+			MovieID  *int64 `json:"movie_id"`
+			Won      bool   `json:"won"`
+		} `json:"awards"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(len(input.Awards) >= 1, "awards", "must contain at least 1 award")
+	v.Check(len(input.Awards) <= 1000, "awards", "must not contain more than 1000 awards")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	awards := make([]*data.Award, len(input.Awards))
+
+	for i, a := range input.Awards {
+		awards[i] = &data.Award{
+			Ceremony: a.Ceremony,
+			Year:     a.Year,
+			Category: a.Category,
+			Nominee:  a.Nominee,
+			MovieID:  a.MovieID,
+			Won:      a.Won,
+		}
+
+		// Validate each award on its own, and report any errors against its position in the list.
+		av := validator.New()
+
+		data.ValidateAward(av, awards[i])
+
+		for key, message := range av.Errors {
+			v.AddError(fmt.Sprintf("awards[%d].%s", i, key), message)
+		}
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Awards.Import(awards)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("awards", "must only refer to existing movies")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"awards": awards}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"greenlight.sparkyvxcx.co/internal/assert"
+	"greenlight.sparkyvxcx.co/internal/jsonlog"
+)
+
+// The import is validated before anything is written to the database, so these cases don't need one.
+func TestImportAwardsValidation(t *testing.T) {
+	app := &application{
+		logger: jsonlog.New(io.Discard, jsonlog.LevelInfo),
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		status   int
+		contains string
+	}{
+		{
+			name:     "Malformed JSON",
+			body:     `{"awards": [`,
+			status:   http.StatusBadRequest,
+			contains: "badly-formed JSON",
+		},
+		{
+			name:     "Unknown Field",
+			body:     `{"awards": [{"ceremony": "oscars", "winner": true}]}`,
+			status:   http.StatusBadRequest,
+			contains: `body contains unknown key \"winner\"`,
+		},
+		{
+			name:     "Wrong Year Type",
+			body:     `{"awards": [{"ceremony": "oscars", "year": "1973"}]}`,
+			status:   http.StatusBadRequest,
+			contains: "incorrect JSON type for field",
+		},
+		{
+			name:     "Empty List",
+			body:     `{"awards": []}`,
+			status:   http.StatusUnprocessableEntity,
+			contains: "must contain at least 1 award",
+		},
+		{
+			name:     "Errors Are Reported Against Their Position",
+			body:     `{"awards": [{"ceremony": "oscars", "year": 1973, "category": "Best Picture", "nominee": "The Godfather"}, {"ceremony": "oscars", "year": 1887, "category": "Best Picture", "nominee": "Wings"}]}`,
+			status:   http.StatusUnprocessableEntity,
+			contains: `"awards[1].year":"must be greater than or equal to 1888"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/awards", strings.NewReader(tt.body))
+
+			app.importAwardsHandler(w, r)
+
+			assert.Equal(t, w.Code, tt.status)
+			assert.Contains(t, w.Body.String(), tt.contains)
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"greenlight.sparkyvxcx.co/internal/data"
+	"greenlight.sparkyvxcx.co/internal/policy"
+	"greenlight.sparkyvxcx.co/internal/validator"
+)
+
+// The listMovieCollaboratorsHandler() lists the collaborators of a movie, to the users who can edit it.
+func (app *application) listMovieCollaboratorsHandler(w http.ResponseWriter, r *http.Request) {
+	movie, ok := app.readMovie(w, r)
+	if !ok {
+		return
+	}
+
+	permitted, err := app.canEditMovie(r, movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !permitted {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	collaborators, err := app.models.MovieCollaborators.GetAllForMovie(movie.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"collaborators": collaborators}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) addMovieCollaboratorHandler(w http.ResponseWriter, r *http.Request) {
+	movie, ok := app.readManageableMovie(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		UserID int64 `json:"user_id"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.UserID > 0, "user_id", "must be provided")
+	v.Check(!movie.IsOwnedBy(input.UserID), "user_id", "must not be the owner of the movie")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.MovieCollaborators.Insert(movie.ID, input.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("user_id", "must refer to an existing user")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateCollaborator):
+			v.AddError("user_id", "is already a collaborator on this movie")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	collaborators, err := app.models.MovieCollaborators.GetAllForMovie(movie.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"collaborators": collaborators}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) removeMovieCollaboratorHandler(w http.ResponseWriter, r *http.Request) {
+	movie, ok := app.readManageableMovie(w, r)
+	if !ok {
+		return
+	}
+
+	userID, err := app.readNamedIDParam(r, "user_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.MovieCollaborators.Delete(movie.ID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": fmt.Sprintf("user %d is no longer a collaborator on movie %d", userID, movie.ID)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The readMovie() helper fetches the movie named by the "id" URL parameter. If the movie can't be
+// returned, a response has already been sent and ok is false.
+func (app *application) readMovie(w http.ResponseWriter, r *http.Request) (*data.Movie, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return movie, true
+}
+
+// The readManageableMovie() helper works like readMovie(), but additionally requires the user to be
+// allowed to manage the movie's collaborators.
+func (app *application) readManageableMovie(w http.ResponseWriter, r *http.Request) (*data.Movie, bool) {
+	movie, ok := app.readMovie(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	actor, err := app.actor(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	if !policy.CanManageMovieCollaborators(actor, movie) {
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+
+	return movie, true
+}
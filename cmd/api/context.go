@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"greenlight.sparkyvxcx.co/internal/data"
+	"greenlight.sparkyvxcx.co/internal/signedtoken"
 )
 
 // Define a custom contextKey type, with the underlying type string.
@@ -13,6 +14,15 @@ type contextKey string
 // Conver the string "user" to a contextKey type and assign it to the user userContextKey constant.
 const userContextKey = contextKey("user")
 
+// The tokenContextKey holds the plaintext authentication token the request was authenticated with.
+const tokenContextKey = contextKey("token")
+
+// The claimsContextKey holds the claims of the signed token the request was authenticated with.
+const claimsContextKey = contextKey("claims")
+
+// The apiKeyContextKey holds the API key the request was authenticated with.
+const apiKeyContextKey = contextKey("api_key")
+
 // The contextSetUser() method returns a new copy of the request with the provided User struct added
 // to the context.
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
@@ -28,3 +38,45 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+// The contextSetToken() method returns a new copy of the request with the plaintext authentication token
+// added to the context.
+func (app *application) contextSetToken(r *http.Request, token string) *http.Request {
+	ctx := context.WithValue(r.Context(), tokenContextKey, token)
+	return r.WithContext(ctx)
+}
+
+// The contextGetToken() method retrieves the plaintext authentication token from the request context. It
+// returns the empty string for anonymous requests.
+func (app *application) contextGetToken(r *http.Request) string {
+	token, _ := r.Context().Value(tokenContextKey).(string)
+	return token
+}
+
+// The contextSetClaims() method returns a new copy of the request with the claims of a signed authentication
+// token added to the context.
+func (app *application) contextSetClaims(r *http.Request, claims *signedtoken.Claims) *http.Request {
+	ctx := context.WithValue(r.Context(), claimsContextKey, claims)
+	return r.WithContext(ctx)
+}
+
+// The contextGetClaims() method retrieves the signed token claims from the request context. It returns nil
+// for requests which weren't authenticated with a signed token.
+func (app *application) contextGetClaims(r *http.Request) *signedtoken.Claims {
+	claims, _ := r.Context().Value(claimsContextKey).(*signedtoken.Claims)
+	return claims
+}
+
+// The contextSetAPIKey() method returns a new copy of the request with the API key it was authenticated with
+// added to the context.
+func (app *application) contextSetAPIKey(r *http.Request, key *data.APIKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+	return r.WithContext(ctx)
+}
+
+// The contextGetAPIKey() method retrieves the API key from the request context. It returns nil for requests
+// which weren't authenticated with an API key.
+func (app *application) contextGetAPIKey(r *http.Request) *data.APIKey {
+	key, _ := r.Context().Value(apiKeyContextKey).(*data.APIKey)
+	return key
+}
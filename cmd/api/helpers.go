@@ -11,6 +11,8 @@ import (
 	"strings"
 
 	"github.com/julienschmidt/httprouter"
+	"greenlight.sparkyvxcx.co/internal/data"
+	"greenlight.sparkyvxcx.co/internal/policy"
 	"greenlight.sparkyvxcx.co/internal/validator"
 )
 
@@ -19,11 +21,17 @@ type envelope map[string]interface{}
 
 // Retrieve the "id" URL parameter from the current request context, then convert it to an integer and return it.
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readNamedIDParam(r, "id")
+}
+
+// Retrieve a named URL parameter holding a record ID (such as "movie_id") from the current request context,
+// then convert it to an integer and return it.
+func (app *application) readNamedIDParam(r *http.Request, name string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
 
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 
 	return id, nil
@@ -140,6 +148,36 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+func (app *application) readBool(qs url.Values, key string, v *validator.Validator) *bool {
+	// Extract the value from the query string.
+	s := qs.Get(key)
+
+	// If no key exist (or the value is empty) then return nil, so that the caller can tell an absent
+	// value apart from an explicit false.
+	if s == "" {
+		return nil
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return nil
+	}
+
+	return &b
+}
+
+// Return the User-Agent header of the request, truncated to a sensible length for storage.
+func (app *application) userAgent(r *http.Request) string {
+	userAgent := r.UserAgent()
+
+	if len(userAgent) > 500 {
+		userAgent = userAgent[:500]
+	}
+
+	return userAgent
+}
+
 // The background() helper accepts an arbitary function as a parameter.
 func (app *application) background(fn func()) {
 	app.wg.Add(1)
@@ -156,3 +194,52 @@ func (app *application) background(fn func()) {
 		fn()
 	}()
 }
+
+// The hasPermission() helper reports whether the user in the request context holds the given
+// permission code. Handlers use it for checks that depend on the record being accessed, where
+// the requirePermission() middleware can't be applied up front.
+func (app *application) hasPermission(r *http.Request, code string) (bool, error) {
+	actor, err := app.actor(r)
+	if err != nil {
+		return false, err
+	}
+
+	return actor.Has(code), nil
+}
+
+// The actor() helper returns the user in the request context along with their permissions, for the
+// decisions of the policy package. Anonymous users hold no permissions.
+func (app *application) actor(r *http.Request) (policy.Actor, error) {
+	user := app.contextGetUser(r)
+
+	if user.IsAnonymous() {
+		return policy.Actor{}, nil
+	}
+
+	actor := policy.Actor{ID: user.ID}
+
+	// A request made with an API key needs the permission in the key's scopes, on top of the owner still
+	// holding it.
+	if key := app.contextGetAPIKey(r); key != nil {
+		actor.Scopes = key.Scopes
+		if actor.Scopes == nil {
+			actor.Scopes = data.Permissions{}
+		}
+	}
+
+	// Signed tokens carry the permissions the user held when the token was issued.
+	if claims := app.contextGetClaims(r); claims != nil {
+		actor.Permissions = data.Permissions(claims.Permissions)
+		return actor, nil
+	}
+
+	// Get the slice of permissions for the user.
+	permissions, err := app.userPermissions(user.ID)
+	if err != nil {
+		return policy.Actor{}, err
+	}
+
+	actor.Permissions = permissions
+
+	return actor, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"greenlight.sparkyvxcx.co/internal/assert"
+	"greenlight.sparkyvxcx.co/internal/data"
+	"greenlight.sparkyvxcx.co/internal/jsonlog"
+)
+
+func TestAllowedEmailDomain(t *testing.T) {
+	app := &application{}
+	app.config.registration.allowedDomains = []string{"example.com"}
+
+	assert.Equal(t, app.allowedEmailDomain("alice@example.com"), true)
+	assert.Equal(t, app.allowedEmailDomain("alice@EXAMPLE.com"), true)
+	assert.Equal(t, app.allowedEmailDomain("alice@mail.example.com"), false)
+	assert.Equal(t, app.allowedEmailDomain("alice@example.com.evil.org"), false)
+}
+
+// wildcardPermissionModel knows only the "movies:*" permission code.
+type wildcardPermissionModel struct {
+	data.PermissionModle
+}
+
+func (m wildcardPermissionModel) GetAll() (data.Permissions, error) {
+	return data.Permissions{"movies:*"}, nil
+}
+
+func TestInvitationPermissionsMustBeKnown(t *testing.T) {
+	app := &application{
+		logger: jsonlog.New(io.Discard, jsonlog.LevelInfo),
+		models: data.Models{
+			Permissions: wildcardPermissionModel{},
+			Users:       stubUserModel{},
+		},
+	}
+
+	// A known wildcard code doesn't make the codes it covers known.
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/v1/admin/invitations",
+		strings.NewReader(`{"email": "bob@example.com", "permissions": ["movies:write"]}`))
+	r = app.contextSetUser(r, &data.User{ID: 1})
+
+	app.adminCreateInvitationHandler(w, r)
+
+	assert.Equal(t, w.Code, http.StatusUnprocessableEntity)
+	assert.Contains(t, w.Body.String(), `\"movies:write\" is not a known permission`)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// The emailLimiter type rate limits requests per email address rather than per client IP address. It
+// is used by the endpoints which send emails to an account, so that they can't be used to flood someone's
+// inbox from many IP addresses.
+type emailLimiter struct {
+	mux      sync.Mutex
+	every    time.Duration
+	burst    int
+	limiters map[string]*rate.Limiter
+}
+
+func newEmailLimiter(every time.Duration, burst int) *emailLimiter {
+	l := &emailLimiter{
+		every:    every,
+		burst:    burst,
+		limiters: make(map[string]*rate.Limiter),
+	}
+
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+
+			// A bucket which has refilled completely behaves exactly like a new one, so it can be dropped.
+			l.mux.Lock()
+			for email, limiter := range l.limiters {
+				if limiter.Tokens() >= float64(l.burst) {
+					delete(l.limiters, email)
+				}
+			}
+			l.mux.Unlock()
+		}
+	}()
+
+	return l
+}
+
+// Report whether another email may be sent to the given address, consuming a token if so.
+func (l *emailLimiter) allow(email string) bool {
+	email = strings.ToLower(email)
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	limiter, found := l.limiters[email]
+	if !found {
+		limiter = rate.NewLimiter(rate.Every(l.every), l.burst)
+		l.limiters[email] = limiter
+	}
+
+	return limiter.Allow()
+}
+
+// The backoffDelay() function returns how long to wait after the given number of consecutive failures:
+// base after the first, doubling with every further failure, up to max.
+func backoffDelay(base, max time.Duration, failures int) time.Duration {
+	if failures < 1 {
+		return 0
+	}
+
+	delay := base
+	for i := 1; i < failures && delay < max; i++ {
+		delay *= 2
+	}
+
+	if delay > max {
+		delay = max
+	}
+
+	return delay
+}
+
+// The loginBackoff type slows down failed logins per client IP address. Every failure doubles the time
+// the client has to wait before trying again, so that an attacker can't spread guesses over many accounts.
+// Failures are forgotten once a client has made none for the forget duration.
+type loginBackoff struct {
+	mux     sync.Mutex
+	base    time.Duration
+	max     time.Duration
+	forget  time.Duration
+	clients map[string]*backoffClient
+}
+
+type backoffClient struct {
+	failures int
+	lastSeen time.Time
+}
+
+func newLoginBackoff(base, max, forget time.Duration) *loginBackoff {
+	b := &loginBackoff{
+		base:    base,
+		max:     max,
+		forget:  forget,
+		clients: make(map[string]*backoffClient),
+	}
+
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+
+			b.mux.Lock()
+			for ip, client := range b.clients {
+				if time.Since(client.lastSeen) > b.forget {
+					delete(b.clients, ip)
+				}
+			}
+			b.mux.Unlock()
+		}
+	}()
+
+	return b
+}
+
+// Return how much longer the client must wait before its next login attempt, or zero if it may try now.
+func (b *loginBackoff) retryAfter(ip string, now time.Time) time.Duration {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	client, found := b.clients[ip]
+	if !found || now.Sub(client.lastSeen) > b.forget {
+		return 0
+	}
+
+	wait := client.lastSeen.Add(backoffDelay(b.base, b.max, client.failures)).Sub(now)
+	if wait < 0 {
+		return 0
+	}
+
+	return wait
+}
+
+// Record a failed login attempt from the client.
+func (b *loginBackoff) fail(ip string, now time.Time) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	client, found := b.clients[ip]
+	if !found || now.Sub(client.lastSeen) > b.forget {
+		client = &backoffClient{}
+		b.clients[ip] = client
+	}
+
+	client.failures++
+	client.lastSeen = now
+}
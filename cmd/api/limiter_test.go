@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"greenlight.sparkyvxcx.co/internal/assert"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{10, time.Minute},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, backoffDelay(time.Second, time.Minute, tt.failures), tt.want)
+	}
+}
+
+func TestLoginBackoff(t *testing.T) {
+	b := newLoginBackoff(time.Second, time.Minute, 15*time.Minute)
+	now := time.Now()
+
+	assert.Equal(t, b.retryAfter("203.0.113.1", now), time.Duration(0))
+
+	b.fail("203.0.113.1", now)
+	b.fail("203.0.113.1", now)
+
+	assert.Equal(t, b.retryAfter("203.0.113.1", now), 2*time.Second)
+	assert.Equal(t, b.retryAfter("203.0.113.1", now.Add(3*time.Second)), time.Duration(0))
+	assert.Equal(t, b.retryAfter("203.0.113.2", now), time.Duration(0))
+
+	t.Run("Failures should be forgotten", func(t *testing.T) {
+		later := now.Add(time.Hour)
+		b.fail("203.0.113.1", later)
+
+		assert.Equal(t, b.retryAfter("203.0.113.1", later), time.Second)
+	})
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"greenlight.sparkyvxcx.co/internal/data"
+	"greenlight.sparkyvxcx.co/internal/validator"
+
+	"github.com/tomasen/realip"
+)
+
+// The recordLoginFailure() helper counts a failed login against both the account and the client IP
+// address, and sends the invalid credentials response. The user is nil when no account has the email
+// address, in which case the failure is counted against the address. If the failure locks an account, the
+// owner is emailed a token to unlock it.
+func (app *application) recordLoginFailure(w http.ResponseWriter, r *http.Request, email string, user *data.User) {
+	app.loginBackoff.fail(realip.FromRequest(r), time.Now())
+
+	maxFailures, lockout := app.config.limiter.login.maxFailures, app.config.limiter.login.lockout
+
+	var failures *data.LoginFailures
+	var err error
+	if user != nil {
+		failures, err = app.models.LoginFailures.RecordFailure(user.ID, maxFailures, lockout)
+	} else {
+		failures, err = app.models.LoginFailures.RecordFailureForEmail(email, maxFailures, lockout)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.logSecurityEvent(r, "login_failed", user)
+
+	if failures.JustLocked && user != nil {
+		app.logSecurityEvent(r, "account_locked", user)
+
+		app.background(func() {
+			token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeUnlock)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+				return
+			}
+
+			data := map[string]interface{}{
+				"unlockToken": token.Plaintext,
+				"lockout":     app.config.limiter.login.lockout.String(),
+			}
+
+			err = app.mailer.Send(user.Email, "token_unlock.tmpl", data)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		})
+	}
+
+	app.invalidCredentialsResponse(w, r)
+}
+
+// The logSecurityEvent() helper logs an authentication related event, with the client's details and, if
+// known, the account it concerns.
+func (app *application) logSecurityEvent(r *http.Request, event string, user *data.User) {
+	properties := map[string]string{
+		"event":      event,
+		"ip":         realip.FromRequest(r),
+		"user_agent": app.userAgent(r),
+	}
+
+	if user != nil {
+		properties["user_id"] = strconv.FormatInt(user.ID, 10)
+	}
+
+	app.logger.PrintInfo("security event", properties)
+}
+
+// The unlockUserHandler() unlocks an account with the token emailed to its owner when it was locked.
+func (app *application) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(data.ScopeUnlock, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired unlock token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.unlockUser(r, user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your account has been unlocked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The unlockUser() helper clears an account's failed logins and any unlock tokens still outstanding.
+func (app *application) unlockUser(r *http.Request, user *data.User) error {
+	err := app.models.LoginFailures.Reset(user.ID)
+	if err != nil {
+		return err
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeUnlock, user.ID)
+	if err != nil {
+		return err
+	}
+
+	app.logSecurityEvent(r, "account_unlocked", user)
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"greenlight.sparkyvxcx.co/internal/assert"
+	"greenlight.sparkyvxcx.co/internal/data"
+	"greenlight.sparkyvxcx.co/internal/jsonlog"
+)
+
+// registeredUserModel has a single account, registered as alice@example.com.
+type registeredUserModel struct {
+	data.UserModel
+}
+
+func (m registeredUserModel) GetByEmail(email string) (*data.User, error) {
+	if email != "alice@example.com" {
+		return nil, data.ErrRecordNotFound
+	}
+
+	return &data.User{ID: 1, Email: email, Activated: true}, nil
+}
+
+// stubLoginFailureModel returns the same failed logins for every account and every unknown address.
+type stubLoginFailureModel struct {
+	data.LoginFailureModel
+	failures data.LoginFailures
+}
+
+func (m stubLoginFailureModel) Get(userID int64) (*data.LoginFailures, error) {
+	failures := m.failures
+	return &failures, nil
+}
+
+func (m stubLoginFailureModel) GetForEmail(email string) (*data.LoginFailures, error) {
+	failures := m.failures
+	return &failures, nil
+}
+
+func TestLoginRestrictionsDontRevealAccounts(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	lockedUntil := now.Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		failures data.LoginFailures
+		wantCode int
+	}{
+		{"locked", data.LoginFailures{Count: 10, LastFailureAt: now, LockedUntil: &lockedUntil}, http.StatusLocked},
+		{"throttled", data.LoginFailures{Count: 3, LastFailureAt: now}, http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &application{
+				logger:       jsonlog.New(io.Discard, jsonlog.LevelInfo),
+				loginBackoff: newLoginBackoff(time.Second, time.Minute, time.Hour),
+				models: data.Models{
+					Users:         registeredUserModel{},
+					LoginFailures: stubLoginFailureModel{failures: tt.failures},
+				},
+			}
+			app.config.limiter.login.backoff = time.Minute
+			app.config.limiter.login.backoffMax = time.Hour
+
+			var bodies []string
+
+			for _, email := range []string{"alice@example.com", "nobody@example.com"} {
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodPost, "/v1/tokens/authentication",
+					strings.NewReader(`{"email": "`+email+`", "password": "pa55word1234"}`))
+
+				app.createAuthenticationTokenHandler(w, r)
+
+				assert.Equal(t, w.Code, tt.wantCode)
+				bodies = append(bodies, w.Body.String())
+			}
+
+			assert.Equal(t, bodies[0], bodies[1])
+		})
+	}
+}
@@ -3,18 +3,24 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"expvar"
 	"flag"
 	"fmt"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"greenlight.sparkyvxcx.co/internal/cache"
 	"greenlight.sparkyvxcx.co/internal/data"
 	"greenlight.sparkyvxcx.co/internal/jsonlog"
 	"greenlight.sparkyvxcx.co/internal/mailer"
+	"greenlight.sparkyvxcx.co/internal/passwordpolicy"
+	"greenlight.sparkyvxcx.co/internal/signedtoken"
+	"greenlight.sparkyvxcx.co/internal/validator"
 
 	_ "github.com/lib/pq"
 )
@@ -26,9 +32,10 @@ var (
 )
 
 type config struct {
-	port int
-	env  string
-	db   struct {
+	port    int
+	env     string
+	baseURL string
+	db      struct {
 		dsn          string
 		maxOpenConns int
 		maxIdleConns int
@@ -38,6 +45,20 @@ type config struct {
 		rps     float64
 		burst   int
 		enabled bool
+		suggest struct {
+			rps   float64
+			burst int
+		}
+		email struct {
+			interval time.Duration
+			burst    int
+		}
+		login struct {
+			maxFailures int
+			lockout     time.Duration
+			backoff     time.Duration
+			backoffMax  time.Duration
+		}
 	}
 	smtp struct {
 		host     string
@@ -49,6 +70,49 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+	auth struct {
+		accessTokenTTL  time.Duration
+		refreshTokenTTL time.Duration
+		tokenMode       string
+		signingKeys     map[string][]byte
+		signingKeyID    string
+		magicLinkTTL    time.Duration
+		magicLinkURL    string
+	}
+	passwords struct {
+		memory       uint
+		iterations   uint
+		parallelism  uint
+		minScore     int
+		breachedFile string
+	}
+	registration struct {
+		mode           string
+		allowedDomains []string
+		invitationTTL  time.Duration
+	}
+	stats struct {
+		cacheTTL  time.Duration
+		cacheSize int
+	}
+	permissions struct {
+		cacheTTL time.Duration
+	}
+	views struct {
+		flushInterval time.Duration
+		batchSize     int
+	}
+	accounts struct {
+		deletionGrace time.Duration
+	}
+	maintenance struct {
+		interval       time.Duration
+		batchSize      int
+		unactivatedAge time.Duration
+	}
+	exports struct {
+		ttl time.Duration
+	}
 }
 
 type application struct {
@@ -57,6 +121,38 @@ type application struct {
 	models data.Models
 	mailer mailer.Mailer
 	wg     sync.WaitGroup
+
+	// statsCache holds recently computed catalog statistics, keyed by the request filters.
+	statsCache *cache.Cache[string, *data.MovieStats]
+
+	// permissionCache holds the permissions and token generations of recently seen users, keyed by user ID.
+	permissionCache *cache.Cache[int64, userAccess]
+
+	// touchCache holds the sessions and API keys whose last use was recorded in the last minute.
+	touchCache *cache.Cache[string, struct{}]
+
+	// permissionInvalidations counts the invalidations of the permission cache, so that permissions loaded
+	// while one happened aren't cached. It's guarded by permissionMu.
+	permissionMu            sync.Mutex
+	permissionInvalidations uint64
+
+	// emailLimiter rate limits the emails sent to an address by the token endpoints.
+	emailLimiter *emailLimiter
+
+	// loginBackoff slows down clients making repeated failed logins.
+	loginBackoff *loginBackoff
+
+	// views buffers movie view counts until they are flushed to the database.
+	views *viewCounter
+
+	// passwordPolicy decides whether new passwords are strong enough.
+	passwordPolicy *passwordpolicy.Policy
+
+	// keyring signs and verifies stateless authentication tokens. It's nil when no signing keys are configured.
+	keyring *signedtoken.Keyring
+
+	// shutdown is closed when the server starts shutting down, to stop long-running background goroutines.
+	shutdown chan struct{}
 }
 
 func main() {
@@ -66,6 +162,7 @@ func main() {
 
 	flag.IntVar(&cfg.port, "port", 4000, "API server port")
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
+	flag.StringVar(&cfg.baseURL, "base-url", "http://localhost:4000", "Public base URL of the API, used for links in emails")
 	flag.StringVar(&cfg.db.dsn, "dsn", os.Getenv("GREENLIGHT_DB_DSN"), "PostgreSQL DSN")
 
 	// database related cli options
@@ -77,6 +174,16 @@ func main() {
 	flag.Float64Var(&cfg.limiter.rps, "limiter-rps", 2, "Rate limiter maximum requests per second")
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-switch", true, "Enable rate limiter")
+	// Suggestions are requested on every keystroke, so clients are expected to debounce them. Their bucket is
+	// stricter than the global one, so that typing can't be used to hammer the database.
+	flag.Float64Var(&cfg.limiter.suggest.rps, "limiter-suggest-rps", 1, "Rate limiter maximum requests per second for title suggestions")
+	flag.IntVar(&cfg.limiter.suggest.burst, "limiter-suggest-burst", 3, "Rate limiter maximum burst for title suggestions")
+	flag.DurationVar(&cfg.limiter.email.interval, "limiter-email-interval", time.Minute, "Rate limiter minimum interval between account emails to the same address")
+	flag.IntVar(&cfg.limiter.email.burst, "limiter-email-burst", 3, "Rate limiter maximum burst of account emails to the same address")
+	flag.IntVar(&cfg.limiter.login.maxFailures, "limiter-login-max-failures", 5, "Failed logins after which an account is locked")
+	flag.DurationVar(&cfg.limiter.login.lockout, "limiter-login-lockout", 15*time.Minute, "How long an account stays locked after too many failed logins")
+	flag.DurationVar(&cfg.limiter.login.backoff, "limiter-login-backoff", time.Second, "Delay imposed after the first failed login, doubling with each further failure")
+	flag.DurationVar(&cfg.limiter.login.backoffMax, "limiter-login-backoff-max", time.Minute, "Maximum delay imposed between failed logins")
 
 	// SMTP related cli options
 	flag.StringVar(&cfg.smtp.host, "smtp-host", "sandbox.smtp.mailtrap.io", "SMTP host")
@@ -90,6 +197,69 @@ func main() {
 		return nil
 	})
 
+	// Authentication related cli options
+	flag.DurationVar(&cfg.auth.accessTokenTTL, "auth-access-token-ttl", 15*time.Minute, "Authentication (access) token lifetime")
+	flag.DurationVar(&cfg.auth.refreshTokenTTL, "auth-refresh-token-ttl", 30*24*time.Hour, "Refresh token lifetime")
+	flag.StringVar(&cfg.auth.tokenMode, "auth-token-mode", "opaque", "Authentication token format to issue (opaque|signed)")
+	flag.StringVar(&cfg.auth.signingKeyID, "auth-signing-key-id", "", "ID of the key to sign authentication tokens with")
+	flag.DurationVar(&cfg.auth.magicLinkTTL, "auth-magic-link-ttl", 15*time.Minute, "Magic login link lifetime")
+	flag.StringVar(&cfg.auth.magicLinkURL, "auth-magic-link-url", "", "URL of the client page which exchanges magic login links (the token is added as a \"token\" query parameter)")
+
+	// Signing keys are read from the environment by default, to keep them out of the process list. Keys no
+	// longer used for signing can be kept in the list until the tokens signed with them have expired.
+	signingKeys, err := signedtoken.ParseKeys(os.Getenv("GREENLIGHT_SIGNING_KEYS"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	cfg.auth.signingKeys = signingKeys
+
+	flag.Func("auth-signing-keys", "Authentication token signing keys (space separated <id>:<base64 key> pairs)", func(val string) error {
+		keys, err := signedtoken.ParseKeys(val)
+		if err != nil {
+			return err
+		}
+
+		cfg.auth.signingKeys = keys
+		return nil
+	})
+
+	// Registration related cli options
+	flag.StringVar(&cfg.registration.mode, "registration-mode", "open", "Who can register without an invitation (open|invite|domain)")
+	flag.Func("registration-allowed-domains", "Email domains allowed to register in domain mode (space separated)", func(val string) error {
+		cfg.registration.allowedDomains = strings.Fields(strings.ToLower(val))
+		return nil
+	})
+	flag.DurationVar(&cfg.registration.invitationTTL, "registration-invitation-ttl", 7*24*time.Hour, "How long invitations can be redeemed for")
+
+	// Password hashing related cli options
+	flag.UintVar(&cfg.passwords.memory, "password-argon2-memory", 64*1024, "Memory used by argon2id password hashing, in KiB")
+	flag.UintVar(&cfg.passwords.iterations, "password-argon2-iterations", 3, "Number of argon2id password hashing iterations")
+	flag.UintVar(&cfg.passwords.parallelism, "password-argon2-parallelism", 2, "Number of threads used by argon2id password hashing")
+	flag.IntVar(&cfg.passwords.minScore, "password-min-score", 2, "Minimum password strength score (0-4)")
+	flag.StringVar(&cfg.passwords.breachedFile, "password-breached-file", "", "File of breached password SHA-1 hashes to reject")
+
+	// Statistics related cli options
+	flag.DurationVar(&cfg.stats.cacheTTL, "stats-cache-ttl", 30*time.Second, "Catalog statistics cache TTL")
+	flag.IntVar(&cfg.stats.cacheSize, "stats-cache-size", 1000, "Maximum number of cached catalog statistics")
+	flag.DurationVar(&cfg.permissions.cacheTTL, "permissions-cache-ttl", time.Minute, "User permissions cache TTL")
+
+	// Popularity tracking related cli options
+	flag.DurationVar(&cfg.views.flushInterval, "views-flush-interval", 10*time.Second, "Interval between movie view count flushes")
+	flag.IntVar(&cfg.views.batchSize, "views-batch-size", 1000, "Number of buffered movies which triggers an early view count flush")
+
+	// Account deletion and data export related cli options
+	flag.DurationVar(&cfg.accounts.deletionGrace, "accounts-deletion-grace", 30*24*time.Hour, "Grace period before a deleted account is purged")
+	flag.DurationVar(&cfg.exports.ttl, "exports-ttl", 7*24*time.Hour, "How long personal data exports can be downloaded for")
+
+	// Database maintenance related cli options
+	flag.DurationVar(&cfg.maintenance.interval, "maintenance-interval", time.Hour, "Interval between database maintenance runs")
+	flag.IntVar(&cfg.maintenance.batchSize, "maintenance-batch-size", 1000, "Number of rows deleted at a time by database maintenance")
+	flag.DurationVar(&cfg.maintenance.unactivatedAge, "maintenance-unactivated-age", 30*24*time.Hour, "Age after which accounts which were never activated are purged")
+
+	// Deleted accounts used to be purged on their own schedule. Keep accepting the old option, as an alias.
+	flag.DurationVar(&cfg.maintenance.interval, "accounts-purge-interval", time.Hour, "Deprecated: use -maintenance-interval")
+
 	displayVersion := flag.Bool("version", false, "Display version and exit")
 
 	flag.Parse()
@@ -102,6 +272,62 @@ func main() {
 
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
 
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "accounts-purge-interval" {
+			logger.PrintInfo("the -accounts-purge-interval option is deprecated, use -maintenance-interval instead", nil)
+		}
+	})
+
+	// Signed tokens are accepted whenever signing keys are configured, even in opaque mode, so that tokens
+	// issued before switching back to opaque tokens stay valid until they expire.
+	var keyring *signedtoken.Keyring
+
+	switch {
+	case cfg.auth.tokenMode != "opaque" && cfg.auth.tokenMode != "signed":
+		logger.PrintFatal(fmt.Errorf("invalid authentication token mode %q", cfg.auth.tokenMode), nil)
+	case len(cfg.auth.signingKeys) > 0:
+		keyring, err = signedtoken.NewKeyring(cfg.auth.signingKeys, cfg.auth.signingKeyID)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+	case cfg.auth.tokenMode == "signed":
+		logger.PrintFatal(errors.New("signed authentication tokens require signing keys"), nil)
+	}
+
+	switch {
+	case !validator.In(cfg.registration.mode, "open", "invite", "domain"):
+		logger.PrintFatal(fmt.Errorf("invalid registration mode %q", cfg.registration.mode), nil)
+	case cfg.registration.mode == "domain" && len(cfg.registration.allowedDomains) == 0:
+		logger.PrintFatal(errors.New("the domain registration mode requires allowed domains"), nil)
+	}
+
+	// Password hashes created with other parameters are upgraded when their users next log in.
+	if cfg.passwords.memory < 8 || cfg.passwords.iterations < 1 || cfg.passwords.parallelism < 1 || cfg.passwords.parallelism > 255 {
+		logger.PrintFatal(errors.New("invalid argon2id password hashing parameters"), nil)
+	}
+
+	data.PasswordHashParams.Memory = uint32(cfg.passwords.memory)
+	data.PasswordHashParams.Iterations = uint32(cfg.passwords.iterations)
+	data.PasswordHashParams.Parallelism = uint8(cfg.passwords.parallelism)
+
+	if cfg.passwords.minScore < 0 || cfg.passwords.minScore > 4 {
+		logger.PrintFatal(errors.New("the minimum password strength score must be between 0 and 4"), nil)
+	}
+
+	passwordPolicy := &passwordpolicy.Policy{MinScore: cfg.passwords.minScore}
+
+	if cfg.passwords.breachedFile != "" {
+		passwordPolicy.Breached, err = passwordpolicy.LoadBreachedList(cfg.passwords.breachedFile)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
+
+		logger.PrintInfo("breached password list loaded", map[string]string{
+			"file":   cfg.passwords.breachedFile,
+			"hashes": strconv.Itoa(passwordPolicy.Breached.Len()),
+		})
+	}
+
 	// Create the connection pool by passing the config struct.
 	db, err := openDB(cfg)
 	if err != nil {
@@ -136,8 +362,34 @@ func main() {
 		logger: logger,
 		models: data.NewModels(db),
 		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+
+		statsCache:      cache.New[string, *data.MovieStats](cfg.stats.cacheTTL, cfg.stats.cacheSize),
+		touchCache:      cache.New[string, struct{}](time.Minute, 0),
+		permissionCache: cache.New[int64, userAccess](cfg.permissions.cacheTTL, 0),
+		emailLimiter:    newEmailLimiter(cfg.limiter.email.interval, cfg.limiter.email.burst),
+		loginBackoff:    newLoginBackoff(cfg.limiter.login.backoff, cfg.limiter.login.backoffMax, cfg.limiter.login.lockout),
+		views:           newViewCounter(),
+		keyring:         keyring,
+		passwordPolicy:  passwordPolicy,
+		shutdown:        make(chan struct{}),
 	}
 
+	// Publish the permission cache hit and miss counts
+	expvar.Publish("permission_cache", expvar.Func(func() interface{} {
+		return map[string]int64{
+			"hits":   app.permissionCache.Hits(),
+			"misses": app.permissionCache.Misses(),
+		}
+	}))
+
+	err = app.startPermissionListener()
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	app.startViewFlusher()
+	app.startMaintenanceWorker()
+
 	// go build-in router
 	// mux := http.NewServeMux()
 	// mux.HandleFunc("/v1/healthcheck", app.healthcheckHandler)
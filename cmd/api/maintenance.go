@@ -0,0 +1,144 @@
+package main
+
+import (
+	"expvar"
+	"strconv"
+	"time"
+)
+
+// maintenanceLockKey is the key of the Postgres advisory lock which makes sure only one instance of the
+// application runs the maintenance jobs at a time.
+const maintenanceLockKey = 7_402_115_001
+
+// The startMaintenanceWorker() helper starts a goroutine which runs the database maintenance jobs at the
+// configured interval: purging the accounts whose deletion grace period is over and the accounts which
+// were never activated, and deleting expired tokens, data exports and invitations. Every instance of the
+// application runs the worker, but an advisory lock makes only one of them do the work each time. Like
+// the view flusher, it's tracked by the application wait group and stops when the server shuts down.
+func (app *application) startMaintenanceWorker() {
+	stats := expvar.NewMap("maintenance")
+
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		ticker := time.NewTicker(app.config.maintenance.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				app.runMaintenance(stats)
+			case <-app.shutdown:
+				return
+			}
+		}
+	}()
+}
+
+// The runMaintenance() helper runs the maintenance jobs once, if no other instance is running them, and
+// records the outcome in the logs and in stats.
+func (app *application) runMaintenance(stats *expvar.Map) {
+	release, acquired, err := app.models.Locks.TryAcquire(maintenanceLockKey)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	if !acquired {
+		stats.Add("skipped", 1)
+		return
+	}
+	defer release()
+
+	start := time.Now()
+
+	counts, err := app.maintain()
+
+	for job, count := range counts {
+		stats.Add(job, count)
+	}
+
+	if err != nil {
+		stats.Add("errors", 1)
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	stats.Add("runs", 1)
+
+	lastRun := new(expvar.Int)
+	lastRun.Set(start.Unix())
+	stats.Set("last_run", lastRun)
+
+	properties := map[string]string{
+		"duration": time.Since(start).String(),
+	}
+	for job, count := range counts {
+		properties[job] = strconv.FormatInt(count, 10)
+	}
+
+	app.logger.PrintInfo("database maintenance completed", properties)
+}
+
+// The maintain() helper runs each maintenance job, and returns the number of rows removed by each. Large
+// deletions are made in batches, so that they don't hold locks on many rows at once. It stops at the first
+// error, returning the counts of the jobs done so far.
+func (app *application) maintain() (map[string]int64, error) {
+	counts := map[string]int64{}
+
+	batchSize := app.config.maintenance.batchSize
+
+	for {
+		n, err := app.models.Tokens.DeleteExpired(batchSize)
+		counts["expired_tokens"] += n
+		if err != nil {
+			return counts, err
+		}
+
+		if n < int64(batchSize) {
+			break
+		}
+	}
+
+	createdBefore := time.Now().Add(-app.config.maintenance.unactivatedAge)
+
+	for {
+		n, err := app.models.Users.PurgeNeverActivated(createdBefore, batchSize)
+		counts["unactivated_users"] += n
+		if err != nil {
+			return counts, err
+		}
+
+		if n < int64(batchSize) {
+			break
+		}
+	}
+
+	n, err := app.models.Users.PurgeDeleted()
+	counts["deleted_users"] = n
+	if err != nil {
+		return counts, err
+	}
+
+	n, err = app.models.Exports.DeleteExpired()
+	counts["expired_exports"] = n
+	if err != nil {
+		return counts, err
+	}
+
+	n, err = app.models.Invitations.DeleteExpired()
+	counts["expired_invitations"] = n
+	if err != nil {
+		return counts, err
+	}
+
+	n, err = app.models.LoginFailures.DeleteStale(app.config.limiter.login.lockout)
+	counts["stale_login_failures"] = n
+	if err != nil {
+		return counts, err
+	}
+
+	return counts, nil
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"expvar"
 	"fmt"
@@ -11,6 +13,7 @@ import (
 	"time"
 
 	"greenlight.sparkyvxcx.co/internal/data"
+	"greenlight.sparkyvxcx.co/internal/signedtoken"
 	"greenlight.sparkyvxcx.co/internal/validator"
 
 	"github.com/felixge/httpsnoop"
@@ -37,7 +40,10 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
-func (app *application) rateLimit(next http.Handler) http.Handler {
+// The rateLimitWith() function returns a middleware which limits each client IP address to an average of
+// rps requests per second, with a maximum burst of burst requests. Every call creates an independent set of
+// buckets, which are shared by all the handlers wrapped with the returned middleware.
+func (app *application) rateLimitWith(rps float64, burst int) func(http.Handler) http.Handler {
 	type client struct {
 		limiter  *rate.Limiter
 		lastSeen time.Time
@@ -67,40 +73,42 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 		}
 	}()
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if app.config.limiter.enabled {
-			// Extract the client's IP address from the request.
-			ip := realip.FromRequest(r)
-
-			// Lock the mutex to prevent this code from being executed concurrently.
-			mux.Lock()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if app.config.limiter.enabled {
+				// Extract the client's IP address from the request.
+				ip := realip.FromRequest(r)
+
+				// Lock the mutex to prevent this code from being executed concurrently.
+				mux.Lock()
+
+				// Check to see if the IP address already exists in the map. If it doesn't, then
+				// initialize a new rate limiter and add the IP address and limiter to the map.
+				if _, found := clients[ip]; !found {
+					// Initialize a new rate limiter which allows an average of 2 requests per second,
+					// with maximum of 4 requests in a single 'burst'.
+					// clients[ip] = &client{limiter: rate.NewLimiter(2, 4)}
+					clients[ip] = &client{limiter: rate.NewLimiter(rate.Limit(rps), burst)}
+				}
 
-			// Check to see if the IP address already exists in the map. If it doesn't, then
-			// initialize a new rate limiter and add the IP address and limiter to the map.
-			if _, found := clients[ip]; !found {
-				// Initialize a new rate limiter which allows an average of 2 requests per second,
-				// with maximum of 4 requests in a single 'burst'.
-				// clients[ip] = &client{limiter: rate.NewLimiter(2, 4)}
-				clients[ip] = &client{limiter: rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst)}
-			}
+				clients[ip].lastSeen = time.Now()
 
-			clients[ip].lastSeen = time.Now()
+				if !clients[ip].limiter.Allow() {
+					mux.Unlock()
+					app.rateLimitExceededResponse(w, r)
+					return
+				}
 
-			if !clients[ip].limiter.Allow() {
+				// Very importantly, unlock the mutex before calling the next handler in the chain.
+				// Notice that we DON't use defer to unlock the mutex, as that would mean that the
+				// mutex isn't unlocked until all the handlers downstream of this middleware have
+				// also returned
 				mux.Unlock()
-				app.rateLimitExceededResponse(w, r)
-				return
 			}
 
-			// Very importantly, unlock the mutex before calling the next handler in the chain.
-			// Notice that we DON't use defer to unlock the mutex, as that would mean that the
-			// mutex isn't unlocked until all the handlers downstream of this middleware have
-			// also returned
-			mux.Unlock()
-		}
-
-		next.ServeHTTP(w, r)
-	})
+			next.ServeHTTP(w, r)
+		})
+	}
 }
 
 func (app *application) authenticate(next http.Handler) http.Handler {
@@ -133,6 +141,88 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		// Extract authentication token from header parts
 		token := headerParts[1]
 
+		// API keys act on behalf of their owner, limited to the key's scopes.
+		if data.IsAPIKey(token) {
+			key, err := app.models.APIKeys.GetForKey(token)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.invalidAuthenticationTokenResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+
+			// The owner may have been purged since the key was looked up.
+			user, err := app.models.Users.Get(key.UserID)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.invalidAuthenticationTokenResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+
+			r = app.contextSetUser(r, user)
+			r = app.contextSetAPIKey(r, key)
+
+			if !app.touchedRecently(fmt.Sprintf("api-key:%d", key.ID)) {
+				app.background(func() {
+					err := app.models.APIKeys.Touch(key.ID)
+					if err != nil {
+						app.logger.PrintError(err, nil)
+					}
+				})
+			}
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Signed tokens carry the user's details with them, so they are verified without loading the
+		// user record. The user added to the context only has its ID and activation state filled in, so
+		// handlers which need anything more must load the user record themselves.
+		if signedtoken.IsSigned(token) {
+			if app.keyring == nil {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			claims, err := app.keyring.Verify(token, time.Now())
+			if err != nil {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			// Tokens issued before the user's signed tokens were revoked, by deactivating the user or
+			// logging them out for instance, are rejected. The token generation is kept in the permission
+			// cache, so this usually doesn't need the database either.
+			access, err := app.getUserAccess(claims.UserID)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.invalidAuthenticationTokenResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+
+			if claims.Generation < access.tokenGeneration {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			r = app.contextSetUser(r, &data.User{ID: claims.UserID, Activated: claims.Activated})
+			r = app.contextSetClaims(r, claims)
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		// Validate the token to ensure it is in a sensible format.
 		v := validator.New()
 
@@ -155,12 +245,37 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 
 		// Call the contextSetUser() helper to add the user information to the request context.
 		r = app.contextSetUser(r, user)
+		r = app.contextSetToken(r, token)
+
+		// Record when the session was last used, without holding up the request.
+		hash := sha256.Sum256([]byte(token))
+		if !app.touchedRecently("token:" + hex.EncodeToString(hash[:])) {
+			app.background(func() {
+				err := app.models.Tokens.Touch(token)
+				if err != nil {
+					app.logger.PrintError(err, nil)
+				}
+			})
+		}
 
 		// Call the next handler in the chain.
 		next.ServeHTTP(w, r)
 	})
 }
 
+// The touchedRecently() helper reports whether the session or API key identified by key was recorded as
+// used in the last minute by this instance, and records it as used otherwise. The last use times are only
+// updated once a minute anyway, so this saves a query per request.
+func (app *application) touchedRecently(key string) bool {
+	if _, found := app.touchCache.Get(key); found {
+		return true
+	}
+
+	app.touchCache.Set(key, struct{}{})
+
+	return false
+}
+
 func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// User the contextGetUser() helper to retrieve the user information from the request context.
@@ -177,6 +292,22 @@ func (app *application) requireAuthenticatedUser(next http.HandlerFunc) http.Han
 	})
 }
 
+// The requireLoggedInUser() middleware works like requireAuthenticatedUser(), but also rejects requests
+// authenticated with an API key. It guards account management, which API keys must not be able to reach
+// whatever their scopes.
+func (app *application) requireLoggedInUser(next http.HandlerFunc) http.HandlerFunc {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.contextGetAPIKey(r) != nil {
+			app.apiKeyNotAllowedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+
+	return app.requireAuthenticatedUser(fn)
+}
+
 func (app *application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
 	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
@@ -197,18 +328,14 @@ func (app *application) requireActivatedUser(next http.HandlerFunc) http.Handler
 
 func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
 	fn := func(w http.ResponseWriter, r *http.Request) {
-		// Retrieve the user from the request context.
-		user := app.contextGetUser(r)
-
-		// Get the slice of permissions for the user.
-		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		// Check if the user holds the required permission. If it doesn't, return 403 Forbidden response.
+		permitted, err := app.hasPermission(r, code)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
 			return
 		}
 
-		// Check if the slice includes the required permission. If it doesn't, return 403 Forbidden response.
-		if !permissions.Include(code) {
+		if !permitted {
 			app.notPermittedResponse(w, r)
 			return
 		}
@@ -221,6 +348,20 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 	return app.requireActivatedUser(fn)
 }
 
+// The requireMethod() middleware rejects requests which don't use the given HTTP method. It's only needed
+// for handlers mounted outside of httprouter, which otherwise takes care of this.
+func (app *application) requireMethod(method string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			app.methodNotAllowedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Origin")
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"greenlight.sparkyvxcx.co/internal/assert"
+	"greenlight.sparkyvxcx.co/internal/cache"
+	"greenlight.sparkyvxcx.co/internal/data"
+	"greenlight.sparkyvxcx.co/internal/jsonlog"
+	"greenlight.sparkyvxcx.co/internal/signedtoken"
+)
+
+type stubPermissionModel struct {
+	data.PermissionModle
+}
+
+func (m stubPermissionModel) GetAllForUser(userID int64) (data.Permissions, error) {
+	return data.Permissions{"movies:read"}, nil
+}
+
+func TestAuthenticateSignedTokenGeneration(t *testing.T) {
+	keyring, err := signedtoken.NewKeyring(map[string][]byte{"test": bytes.Repeat([]byte("k"), signedtoken.MinKeyLength)}, "test")
+	assert.NilError(t, err)
+
+	app := &application{
+		logger:          jsonlog.New(io.Discard, jsonlog.LevelInfo),
+		keyring:         keyring,
+		permissionCache: cache.New[int64, userAccess](time.Minute, 0),
+		models: data.Models{
+			Permissions: stubPermissionModel{},
+			Users:       stubUserModel{tokenGeneration: 1},
+		},
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name       string
+		generation int32
+		status     int
+	}{
+		{name: "Current Generation Is Accepted", generation: 1, status: http.StatusNoContent},
+		{name: "Revoked Generation Is Rejected", generation: 0, status: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+
+			token, err := keyring.Sign(signedtoken.Claims{
+				UserID:      1,
+				Activated:   true,
+				Permissions: []string{"movies:read"},
+				Generation:  tt.generation,
+				IssuedAt:    now.Unix(),
+				Expiry:      now.Add(time.Minute).Unix(),
+			})
+			assert.NilError(t, err)
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/v1/movies", nil)
+			r.Header.Set("Authorization", "Bearer "+token)
+
+			app.authenticate(next).ServeHTTP(w, r)
+
+			assert.Equal(t, w.Code, tt.status)
+		})
+	}
+}
+
+func TestTouchedRecently(t *testing.T) {
+	app := &application{
+		touchCache: cache.New[string, struct{}](time.Minute, 0),
+	}
+
+	assert.Equal(t, app.touchedRecently("token:a"), false)
+	assert.Equal(t, app.touchedRecently("token:a"), true)
+	assert.Equal(t, app.touchedRecently("api-key:1"), false)
+}
@@ -6,14 +6,16 @@ import (
 	"net/http"
 
 	"greenlight.sparkyvxcx.co/internal/data"
+	"greenlight.sparkyvxcx.co/internal/policy"
 	"greenlight.sparkyvxcx.co/internal/validator"
 )
 
 func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request) {
 	// Define an input struct to hold the expected values from the request query string.
 	var input struct {
-		Title  string
-		Geners []string
+		Title    string
+		Geners   []string
+		WonAward *bool
 		data.Filters
 	}
 
@@ -27,6 +29,7 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 	// of an empty string and an empty slice respectively if they are not provided by the client.
 	input.Title = app.readString(qs, "title", "")
 	input.Geners = app.readCSV(qs, "genres", []string{})
+	input.WonAward = app.readBool(qs, "won_award", v)
 
 	// Get the page and page_size query string values as integers. Set the default page value to 1
 	// and default page_size to 20, and that we pass the validator instance as the final argument here.
@@ -38,7 +41,7 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 	input.Filters.Sort = app.readString(qs, "sort", "id")
 
 	// Add the supported sort values for this endpoint to the sort whitelist
-	input.Filters.SortWhitelist = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	input.Filters.SortWhitelist = []string{"id", "title", "year", "runtime", "popularity", "-id", "-title", "-year", "-runtime", "-popularity"}
 
 	// Check the Validator instance for any errors and use the failedValidationResponse() helper to send
 	// the client a response if necessary.
@@ -47,7 +50,7 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Geners, input.Filters)
+	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Geners, input.WonAward, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -59,6 +62,41 @@ func (app *application) listMoviesHandler(w http.ResponseWriter, r *http.Request
 	}
 }
 
+func (app *application) suggestMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Query string
+		Limit int
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Query = app.readString(qs, "q", "")
+	input.Limit = app.readInt(qs, "limit", 10, v)
+
+	v.Check(input.Query != "", "q", "must be provided")
+	v.Check(len(input.Query) <= 100, "q", "must not be more than 100 bytes long")
+	v.Check(input.Limit > 0, "limit", "must be greater than zero")
+	v.Check(input.Limit <= 20, "limit", "must be a maximum of 20")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	suggestions, err := app.models.Movies.Suggest(input.Query, input.Limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"suggestions": suggestions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Request) {
 	// w.Write([]byte("Create a new movie"))
 
@@ -77,10 +115,11 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	movie := &data.Movie{
-		Title:   input.Title,
-		Year:    input.Year,
-		Runtime: input.Runtime,
-		Genres:  input.Genres,
+		Title:     input.Title,
+		Year:      input.Year,
+		Runtime:   input.Runtime,
+		Genres:    input.Genres,
+		CreatedBy: &app.contextGetUser(r).ID,
 	}
 
 	// Initialize a new Validator instance.
@@ -139,12 +178,52 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	app.recordMovieView(movie.ID)
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"movie": movie}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+func (app *application) trendingMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	// Map the supported window values to the number of days of view counts they cover.
+	windows := map[string]int{"24h": 1, "7d": 7}
+
+	var input struct {
+		Window string
+		Limit  int
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Window = app.readString(qs, "window", "24h")
+	input.Limit = app.readInt(qs, "limit", 20, v)
+
+	_, ok := windows[input.Window]
+	v.Check(ok, "window", "must be 24h or 7d")
+	v.Check(input.Limit > 0, "limit", "must be greater than zero")
+	v.Check(input.Limit <= 100, "limit", "must be a maximum of 100")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	movies, err := app.models.MovieViews.GetTrending(windows[input.Window], input.Limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"movies": movies, "window": input.Window}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract the movie ID from the URL.
 	id, err := app.readIDParam(r)
@@ -166,6 +245,17 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	permitted, err := app.canEditMovie(r, movie)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !permitted {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
 	// Declare an input struct to hold the expected data from the client.
 	var input struct {
 		Title   *string       `json:"title"`
@@ -230,6 +320,28 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	movie, err := app.models.Movies.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	actor, err := app.actor(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !policy.CanDeleteMovie(actor, movie) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
 	err = app.models.Movies.Delete(id)
 	if err != nil {
 		switch {
@@ -246,3 +358,23 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// The canEditMovie() helper reports whether the user in the request context may update the movie,
+// according to policy.CanEditMovie(). Collaborators are only looked up when they make a difference.
+func (app *application) canEditMovie(r *http.Request, movie *data.Movie) (bool, error) {
+	actor, err := app.actor(r)
+	if err != nil {
+		return false, err
+	}
+
+	if policy.CanEditMovie(actor, movie, false) {
+		return true, nil
+	}
+
+	collaborator, err := app.models.MovieCollaborators.Exists(movie.ID, actor.ID)
+	if err != nil {
+		return false, err
+	}
+
+	return policy.CanEditMovie(actor, movie, collaborator), nil
+}
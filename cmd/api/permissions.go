@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"greenlight.sparkyvxcx.co/internal/data"
+
+	"github.com/lib/pq"
+)
+
+// userAccess holds what the permission cache keeps about a user: the permissions they hold, and the token
+// generation that signed authentication tokens must have been issued for to still be valid.
+type userAccess struct {
+	permissions     data.Permissions
+	tokenGeneration int32
+}
+
+// The getUserAccess() helper returns the permissions and token generation of a user, from the permission
+// cache when possible. It returns data.ErrRecordNotFound if the user doesn't exist.
+func (app *application) getUserAccess(userID int64) (userAccess, error) {
+	if access, found := app.permissionCache.Get(userID); found {
+		return access, nil
+	}
+
+	// An invalidation arriving while the database is queried may concern changes the query didn't see, so
+	// the result is only cached if there was none in the meantime.
+	app.permissionMu.Lock()
+	invalidations := app.permissionInvalidations
+	app.permissionMu.Unlock()
+
+	permissions, err := app.models.Permissions.GetAllForUser(userID)
+	if err != nil {
+		return userAccess{}, err
+	}
+
+	generation, err := app.models.Users.GetTokenGeneration(userID)
+	if err != nil {
+		return userAccess{}, err
+	}
+
+	access := userAccess{permissions: permissions, tokenGeneration: generation}
+
+	app.permissionMu.Lock()
+	if app.permissionInvalidations == invalidations {
+		app.permissionCache.Set(userID, access)
+	}
+	app.permissionMu.Unlock()
+
+	return access, nil
+}
+
+// The userPermissions() helper returns the permissions held by a user, from the permission cache when
+// possible.
+func (app *application) userPermissions(userID int64) (data.Permissions, error) {
+	access, err := app.getUserAccess(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return access.permissions, nil
+}
+
+// The invalidatePermissions() helper drops cached permissions according to the payload of a notification
+// on data.PermissionsChannel.
+func (app *application) invalidatePermissions(payload string) {
+	app.permissionMu.Lock()
+	defer app.permissionMu.Unlock()
+
+	app.permissionInvalidations++
+
+	if payload == data.PermissionsChangedAll {
+		app.permissionCache.Clear()
+		return
+	}
+
+	userID, err := strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		// Clearing everything is always safe.
+		app.permissionCache.Clear()
+		return
+	}
+
+	app.permissionCache.Delete(userID)
+}
+
+// The startPermissionListener() helper starts a goroutine which listens for permission changes made by
+// any instance of the application, and invalidates the permission cache accordingly. Notifications sent
+// while the listener was disconnected are lost, so the whole cache is cleared when it reconnects.
+func (app *application) startPermissionListener() error {
+	listener := pq.NewListener(app.config.db.dsn, 10*time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	err := listener.Listen(data.PermissionsChannel)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+		defer listener.Close()
+
+		for {
+			select {
+			case n := <-listener.Notify:
+				app.handlePermissionNotification(n)
+			case <-app.shutdown:
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// The handlePermissionNotification() helper invalidates the permission cache for a notification received by
+// the permission listener.
+func (app *application) handlePermissionNotification(n *pq.Notification) {
+	// A nil notification is sent after the connection was re-established, when notifications may have been
+	// missed.
+	if n == nil {
+		app.invalidatePermissions(data.PermissionsChangedAll)
+		return
+	}
+
+	app.invalidatePermissions(n.Extra)
+}
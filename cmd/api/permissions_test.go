@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"greenlight.sparkyvxcx.co/internal/assert"
+	"greenlight.sparkyvxcx.co/internal/cache"
+	"greenlight.sparkyvxcx.co/internal/data"
+
+	"github.com/lib/pq"
+)
+
+func TestHandlePermissionNotification(t *testing.T) {
+	app := &application{
+		permissionCache: cache.New[int64, userAccess](time.Minute, 0),
+	}
+
+	app.permissionCache.Set(1, userAccess{permissions: data.Permissions{"movies:read"}})
+	app.permissionCache.Set(2, userAccess{permissions: data.Permissions{"movies:read"}})
+
+	app.handlePermissionNotification(&pq.Notification{Channel: data.PermissionsChannel, Extra: "1"})
+
+	_, found := app.permissionCache.Get(1)
+	assert.Equal(t, found, false)
+
+	_, found = app.permissionCache.Get(2)
+	assert.Equal(t, found, true)
+
+	// The listener reconnected, so any notification may have been missed.
+	app.handlePermissionNotification(nil)
+
+	_, found = app.permissionCache.Get(2)
+	assert.Equal(t, found, false)
+}
+
+func TestInvalidatePermissions(t *testing.T) {
+	app := &application{
+		permissionCache: cache.New[int64, userAccess](time.Minute, 0),
+	}
+
+	app.permissionCache.Set(1, userAccess{permissions: data.Permissions{"movies:read"}})
+	app.permissionCache.Set(2, userAccess{permissions: data.Permissions{"movies:read"}})
+
+	app.invalidatePermissions("1")
+
+	_, found := app.permissionCache.Get(1)
+	assert.Equal(t, found, false)
+
+	_, found = app.permissionCache.Get(2)
+	assert.Equal(t, found, true)
+
+	app.invalidatePermissions(data.PermissionsChangedAll)
+
+	_, found = app.permissionCache.Get(2)
+	assert.Equal(t, found, false)
+}
+
+// racingPermissionModel calls invalidate while permissions are being loaded, like a notification arriving
+// in the middle of the query would.
+type racingPermissionModel struct {
+	data.PermissionModle
+	invalidate func()
+}
+
+func (m racingPermissionModel) GetAllForUser(userID int64) (data.Permissions, error) {
+	m.invalidate()
+	return data.Permissions{"movies:read"}, nil
+}
+
+func TestUserPermissionsInvalidatedWhileLoading(t *testing.T) {
+	app := &application{
+		permissionCache: cache.New[int64, userAccess](time.Minute, 0),
+	}
+
+	app.models = data.Models{
+		Permissions: racingPermissionModel{invalidate: func() { app.invalidatePermissions("1") }},
+		Users:       stubUserModel{},
+	}
+
+	permissions, err := app.userPermissions(1)
+	assert.NilError(t, err)
+	assert.Equal(t, permissions.Include("movies:read"), true)
+
+	_, found := app.permissionCache.Get(1)
+	assert.Equal(t, found, false)
+
+	app.models.Permissions = stubPermissionModel{}
+
+	_, err = app.userPermissions(1)
+	assert.NilError(t, err)
+
+	_, found = app.permissionCache.Get(1)
+	assert.Equal(t, found, true)
+}
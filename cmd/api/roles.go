@@ -0,0 +1,439 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"greenlight.sparkyvxcx.co/internal/data"
+	"greenlight.sparkyvxcx.co/internal/validator"
+)
+
+func (app *application) adminListRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := app.models.Roles.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"roles": roles}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) adminAssignRolesHandler(w http.ResponseWriter, r *http.Request) {
+	app.adminChangeRoles(w, r, true)
+}
+
+func (app *application) adminUnassignRolesHandler(w http.ResponseWriter, r *http.Request) {
+	app.adminChangeRoles(w, r, false)
+}
+
+// The adminChangeRoles() helper assigns or removes the roles listed in the request body, and responds
+// with the user's roles and resulting permissions afterwards.
+func (app *application) adminChangeRoles(w http.ResponseWriter, r *http.Request, assign bool) {
+	user, ok := app.readTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Roles []string `json:"roles"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	roles, ok := app.validateRoles(w, r, v, input.Roles)
+	if !ok {
+		return
+	}
+
+	// Administrators can't lock themselves out of the admin API by dropping the role which lets them in.
+	// Permissions held through groups or direct grants aren't considered, which errs on the safe side.
+	if !assign && user.ID == app.contextGetUser(r).ID {
+		for _, role := range roles {
+			if role.Permissions.Include("users:admin") {
+				v.AddError("roles", fmt.Sprintf("you can't remove your own %q role", role.Name))
+				break
+			}
+		}
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	action := "roles.unassign"
+	if assign {
+		action = "roles.assign"
+		err = app.models.Roles.AddForUser(user.ID, input.Roles...)
+	} else {
+		err = app.models.Roles.RemoveForUser(user.ID, input.Roles...)
+		if err == nil {
+			// Signed authentication tokens carry the permissions the user held when they were issued.
+			err = app.models.Users.RevokeSignedTokens(user.ID)
+		}
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.audit(r, action, user, map[string]interface{}{"roles": input.Roles})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	names, err := app.models.Roles.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if permissions == nil {
+		permissions = data.Permissions{}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"roles": names, "permissions": permissions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) adminListGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	groups, err := app.models.Groups.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"groups": groups}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) adminCreateGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name  string   `json:"name"`
+		Roles []string `json:"roles"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	group := &data.Group{Name: input.Name}
+
+	v := validator.New()
+
+	data.ValidateGroup(v, group)
+
+	if len(input.Roles) > 0 {
+		if _, ok := app.validateRoles(w, r, v, input.Roles); !ok {
+			return
+		}
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Groups.Insert(group)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateGroupName):
+			v.AddError("name", "a group with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if len(input.Roles) > 0 {
+		err = app.models.Groups.AddRoles(group.ID, input.Roles...)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.audit(r, "group.create", nil, map[string]interface{}{"group_id": group.ID, "name": group.Name, "roles": input.Roles})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	group, err = app.models.Groups.Get(group.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/admin/groups/%d", group.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"group": group}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) adminShowGroupHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.readTargetGroup(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"group": group}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) adminDeleteGroupHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := app.readTargetGroup(w, r)
+	if !ok {
+		return
+	}
+
+	// Revoke the members' signed authentication tokens while the group still tells who they are.
+	err := app.models.Users.RevokeSignedTokensForGroup(group.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Groups.Delete(group.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.audit(r, "group.delete", nil, map[string]interface{}{"group_id": group.ID, "name": group.Name})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "group successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) adminAddGroupMembersHandler(w http.ResponseWriter, r *http.Request) {
+	app.adminChangeGroupMembers(w, r, true)
+}
+
+func (app *application) adminRemoveGroupMembersHandler(w http.ResponseWriter, r *http.Request) {
+	app.adminChangeGroupMembers(w, r, false)
+}
+
+// The adminChangeGroupMembers() helper adds or removes the users listed in the request body, and responds
+// with the group afterwards. User IDs which don't belong to any user are ignored.
+func (app *application) adminChangeGroupMembers(w http.ResponseWriter, r *http.Request, add bool) {
+	group, ok := app.readTargetGroup(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		UserIDs []int64 `json:"user_ids"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(len(input.UserIDs) >= 1, "user_ids", "must contain at least 1 user ID")
+	v.Check(len(input.UserIDs) <= 1000, "user_ids", "must not contain more than 1000 user IDs")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	action := "group.remove_members"
+	if add {
+		action = "group.add_members"
+		err = app.models.Groups.AddMembers(group.ID, input.UserIDs...)
+	} else {
+		err = app.models.Groups.RemoveMembers(group.ID, input.UserIDs...)
+		if err == nil {
+			err = app.models.Users.RevokeSignedTokens(input.UserIDs...)
+		}
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.audit(r, action, nil, map[string]interface{}{"group_id": group.ID, "user_ids": input.UserIDs})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.respondWithGroup(w, r, group.ID)
+}
+
+func (app *application) adminAddGroupRolesHandler(w http.ResponseWriter, r *http.Request) {
+	app.adminChangeGroupRoles(w, r, true)
+}
+
+func (app *application) adminRemoveGroupRolesHandler(w http.ResponseWriter, r *http.Request) {
+	app.adminChangeGroupRoles(w, r, false)
+}
+
+// The adminChangeGroupRoles() helper assigns or removes the roles listed in the request body, and responds
+// with the group afterwards.
+func (app *application) adminChangeGroupRoles(w http.ResponseWriter, r *http.Request, add bool) {
+	group, ok := app.readTargetGroup(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Roles []string `json:"roles"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if _, ok := app.validateRoles(w, r, v, input.Roles); !ok {
+		return
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	action := "group.remove_roles"
+	if add {
+		action = "group.add_roles"
+		err = app.models.Groups.AddRoles(group.ID, input.Roles...)
+	} else {
+		err = app.models.Groups.RemoveRoles(group.ID, input.Roles...)
+		if err == nil {
+			err = app.models.Users.RevokeSignedTokensForGroup(group.ID)
+		}
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.audit(r, action, nil, map[string]interface{}{"group_id": group.ID, "roles": input.Roles})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.respondWithGroup(w, r, group.ID)
+}
+
+// The validateRoles() helper checks that names lists at least one role and only known roles, adding any
+// problem to v. It returns the matching roles; if they can't be looked up, a response has already been
+// sent and ok is false.
+func (app *application) validateRoles(w http.ResponseWriter, r *http.Request, v *validator.Validator, names []string) ([]*data.Role, bool) {
+	known, err := app.models.Roles.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	v.Check(len(names) >= 1, "roles", "must contain at least 1 role")
+
+	var roles []*data.Role
+
+	for _, name := range names {
+		var match *data.Role
+
+		for _, role := range known {
+			if role.Name == name {
+				match = role
+				break
+			}
+		}
+
+		if match == nil {
+			v.AddError("roles", fmt.Sprintf("%q is not a known role", name))
+			break
+		}
+
+		roles = append(roles, match)
+	}
+
+	return roles, true
+}
+
+// The readTargetGroup() helper fetches the group named by the "id" URL parameter. If the group can't be
+// returned, a response has already been sent and ok is false.
+func (app *application) readTargetGroup(w http.ResponseWriter, r *http.Request) (*data.Group, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	group, err := app.models.Groups.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return group, true
+}
+
+func (app *application) respondWithGroup(w http.ResponseWriter, r *http.Request, id int64) {
+	group, err := app.models.Groups.Get(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"group": group}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -8,6 +8,13 @@ import (
 )
 
 func (app *application) routes() http.Handler {
+	return app.metrics(app.recoverPanic(app.enableCORS(app.handlers())))
+}
+
+// The handlers() helper builds the routing tree, without the metrics, panic recovery and CORS middleware
+// wrapped around it. The metrics middleware publishes expvar variables, which can only be done once per
+// process, so tests which need the routes use this instead of routes().
+func (app *application) handlers() http.Handler {
 	// Initialize a new httprouter router instance.
 	router := httprouter.New()
 
@@ -22,19 +29,103 @@ func (app *application) routes() http.Handler {
 	// Register the relevant methods, URL patterns and handler functions for our endpoints using the HandlerFunc() method.
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
 
-	// Endpoints related to movie operations
+	// Endpoints related to movie operations. Editing and deleting a movie are further restricted by its
+	// ownership and collaborators.
 	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermission("movies:read", app.listMoviesHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermission("movies:write", app.createMovieHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermission("movies:read", app.showMovieHandler))
 	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermission("movies:write", app.updateMovieHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermission("movies:write", app.deleteMovieHandler))
 
+	// Endpoints related to movie collaborators
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/collaborators", app.requirePermission("movies:read", app.listMovieCollaboratorsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/collaborators", app.requirePermission("movies:write", app.addMovieCollaboratorHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/collaborators/:user_id", app.requirePermission("movies:write", app.removeMovieCollaboratorHandler))
+
+	// Endpoints related to awards
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/awards", app.requirePermission("movies:read", app.listMovieAwardsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/awards/:ceremony/:year", app.requirePermission("movies:read", app.listCeremonyAwardsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/awards", app.requirePermission("movies:write", app.importAwardsHandler))
+
+	// Endpoints related to catalog statistics
+	router.HandlerFunc(http.MethodGet, "/v1/stats/movies", app.requirePermission("movies:read", app.movieStatsHandler))
+
+	// Endpoints related to movie collections
+	router.HandlerFunc(http.MethodGet, "/v1/collections", app.requirePermission("movies:read", app.listCollectionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/collections", app.requirePermission("movies:read", app.createCollectionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/collections/:id", app.requirePermission("movies:read", app.showCollectionHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/collections/:id", app.requirePermission("movies:read", app.updateCollectionHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/collections/:id", app.requirePermission("movies:read", app.deleteCollectionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/collections/:id/movies", app.requirePermission("movies:read", app.listCollectionMoviesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/collections/:id/movies", app.requirePermission("movies:read", app.addCollectionMovieHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/collections/:id/movies", app.requirePermission("movies:read", app.reorderCollectionMoviesHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/collections/:id/movies/:movie_id", app.requirePermission("movies:read", app.removeCollectionMovieHandler))
+
 	// Endpoints related to user operations
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/users/invited", app.redeemInvitationHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/unlocked", app.unlockUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/email", app.confirmEmailChangeHandler)
+
+	// Endpoints related to the current user
+	router.HandlerFunc(http.MethodGet, "/v1/users/me", app.requireAuthenticatedUser(app.showCurrentUserHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me", app.requireLoggedInUser(app.updateCurrentUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me", app.requireLoggedInUser(app.deleteCurrentUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/deletion", app.requireLoggedInUser(app.cancelAccountDeletionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/export", app.requireLoggedInUser(app.exportCurrentUserHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/password", app.requireLoggedInUser(app.updateCurrentUserPasswordHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/email", app.requireLoggedInUser(app.requestEmailChangeHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/sessions", app.requireLoggedInUser(app.listSessionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/sessions", app.requireLoggedInUser(app.deleteAllSessionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/sessions/:id", app.requireLoggedInUser(app.deleteSessionHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/api-keys", app.requireLoggedInUser(app.listAPIKeysHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/api-keys", app.requireLoggedInUser(app.createAPIKeyHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/api-keys/:id", app.requireLoggedInUser(app.deleteAPIKeyHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/two-factor", app.requireLoggedInUser(app.requirePermission("movies:write", app.beginTwoFactorHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/two-factor/confirm", app.requireLoggedInUser(app.requirePermission("movies:write", app.confirmTwoFactorHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/two-factor", app.requireLoggedInUser(app.disableTwoFactorHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/exports/:token", app.downloadExportHandler)
+
+	// Endpoints related to user administration
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users", app.requirePermission("users:admin", app.adminListUsersHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id", app.requirePermission("users:admin", app.adminShowUserHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/activated", app.requirePermission("users:admin", app.adminUpdateUserActivatedHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/permissions", app.requirePermission("users:admin", app.adminGrantPermissionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/permissions", app.requirePermission("users:admin", app.adminRevokePermissionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/sessions", app.requirePermission("users:admin", app.adminLogoutUserHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/password-reset", app.requirePermission("users:admin", app.adminResetUserPasswordHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/unlock", app.requirePermission("users:admin", app.adminUnlockUserHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/roles", app.requirePermission("users:admin", app.adminAssignRolesHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/roles", app.requirePermission("users:admin", app.adminUnassignRolesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/audit-events", app.requirePermission("users:admin", app.adminListAuditEventsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/invitations", app.requirePermission("users:admin", app.adminListInvitationsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/invitations", app.requirePermission("users:admin", app.adminCreateInvitationHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/invitations/:id", app.requirePermission("users:admin", app.adminDeleteInvitationHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/roles", app.requirePermission("users:admin", app.adminListRolesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/groups", app.requirePermission("users:admin", app.adminListGroupsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/groups", app.requirePermission("users:admin", app.adminCreateGroupHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/groups/:id", app.requirePermission("users:admin", app.adminShowGroupHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/groups/:id", app.requirePermission("users:admin", app.adminDeleteGroupHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/groups/:id/members", app.requirePermission("users:admin", app.adminAddGroupMembersHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/groups/:id/members", app.requirePermission("users:admin", app.adminRemoveGroupMembersHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/groups/:id/roles", app.requirePermission("users:admin", app.adminAddGroupRolesHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/groups/:id/roles", app.requirePermission("users:admin", app.adminRemoveGroupRolesHandler))
 
 	// Endpoints related to token
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/tokens/authentication", app.requireLoggedInUser(app.deleteAuthenticationTokenHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/two-factor", app.createTwoFactorAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/refresh", app.refreshAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.createActivationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/magic-link", app.createMagicLinkTokenHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/tokens/magic-link", app.exchangeMagicLinkTokenHandler)
 
 	// Endpoints related to metric/debug to the expvar handler
 	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
@@ -49,5 +140,21 @@ func (app *application) routes() http.Handler {
 	// return app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router))))
 
 	// Use the new metrics() middleware at the start of the chain.
-	return app.metrics(app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router)))))
+	// return app.metrics(app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router)))))
+
+	// httprouter can't register static paths such as /v1/movies/suggest next to the /v1/movies/:id wildcard,
+	// so those are dispatched by a ServeMux in front of the router. Title suggestions are requested on every
+	// keystroke, so they are rate limited in their own bucket instead of the global one.
+	suggest := app.requireMethod(http.MethodGet, app.requirePermission("movies:read", app.suggestMoviesHandler))
+	trending := app.requireMethod(http.MethodGet, app.requirePermission("movies:read", app.trendingMoviesHandler))
+
+	rateLimit := app.rateLimitWith(app.config.limiter.rps, app.config.limiter.burst)
+	suggestRateLimit := app.rateLimitWith(app.config.limiter.suggest.rps, app.config.limiter.suggest.burst)
+
+	mux := http.NewServeMux()
+	mux.Handle("/v1/movies/suggest", suggestRateLimit(app.authenticate(suggest)))
+	mux.Handle("/v1/movies/trending", rateLimit(app.authenticate(trending)))
+	mux.Handle("/", rateLimit(app.authenticate(router)))
+
+	return mux
 }
@@ -59,7 +59,15 @@ func (app *application) serve() error {
 
 		app.logger.PrintInfo("completing background tasks", map[string]string{"addr": srv.Addr})
 
+		// Signal the long-running background goroutines to finish up.
+		close(app.shutdown)
+
 		app.wg.Wait()
+
+		app.statsCache.Close()
+		app.permissionCache.Close()
+		app.touchCache.Close()
+
 		shutdownError <- nil
 	}()
 
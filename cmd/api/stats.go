@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"greenlight.sparkyvxcx.co/internal/validator"
+)
+
+func (app *application) movieStatsHandler(w http.ResponseWriter, r *http.Request) {
+	// Accept the same title and genres filters as listMoviesHandler.
+	var input struct {
+		Title  string
+		Genres []string
+	}
+
+	qs := r.URL.Query()
+
+	input.Title = app.readString(qs, "title", "")
+	input.Genres = app.readCSV(qs, "genres", []string{})
+
+	v := validator.New()
+
+	v.Check(len(input.Title) <= 500, "title", "must not be more than 500 bytes long")
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	title, genres := normalizeStatsFilters(input.Title, input.Genres)
+	key := title + "\x00" + strings.Join(genres, ",")
+
+	stats, found := app.statsCache.Get(key)
+	if !found {
+		var err error
+
+		stats, err = app.models.Movies.GetStats(title, genres)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.statsCache.Set(key, stats)
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"stats": stats}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The normalizeStatsFilters() helper returns the statistics filters in a canonical form, so that
+// equivalent requests share a cache entry. The title search ignores case and extra whitespace, and the
+// genre order and duplicate genres don't change the result.
+func normalizeStatsFilters(title string, genres []string) (string, []string) {
+	title = strings.ToLower(strings.Join(strings.Fields(title), " "))
+
+	normalized := []string{}
+	for _, genre := range genres {
+		if genre != "" && !validator.In(genre, normalized...) {
+			normalized = append(normalized, genre)
+		}
+	}
+	sort.Strings(normalized)
+
+	return title, normalized
+}
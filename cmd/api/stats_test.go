@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"greenlight.sparkyvxcx.co/internal/assert"
+)
+
+func TestNormalizeStatsFilters(t *testing.T) {
+	tests := []struct {
+		name   string
+		title  string
+		genres []string
+		want   string
+	}{
+		{"Empty", "", []string{}, "\x00"},
+		{"Title case and spacing", "  The   GODFATHER ", nil, "the godfather\x00"},
+		{"Genre order", "", []string{"drama", "crime"}, "\x00crime,drama"},
+		{"Duplicate genres", "", []string{"drama", "crime", "drama", ""}, "\x00crime,drama"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			title, genres := normalizeStatsFilters(tt.title, tt.genres)
+
+			assert.Equal(t, title+"\x00"+strings.Join(genres, ","), tt.want)
+		})
+	}
+}
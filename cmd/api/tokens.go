@@ -3,10 +3,14 @@ package main
 import (
 	"errors"
 	"net/http"
+	"net/url"
 	"time"
 
 	"greenlight.sparkyvxcx.co/internal/data"
+	"greenlight.sparkyvxcx.co/internal/signedtoken"
 	"greenlight.sparkyvxcx.co/internal/validator"
+
+	"github.com/tomasen/realip"
 )
 
 func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
@@ -32,9 +36,133 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
+	ip := realip.FromRequest(r)
+
+	// Throttling is checked before the password, so that throttled attempts don't cost a bcrypt comparison.
+	if wait := app.loginBackoff.retryAfter(ip, time.Now()); wait > 0 {
+		app.logSecurityEvent(r, "login_throttled", nil)
+		app.tooManyLoginAttemptsResponse(w, r, wait)
+		return
+	}
+
+	// An address without an account is locked and throttled like an account, so that the responses don't
+	// reveal which addresses are registered. Its user is nil.
 	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var failures *data.LoginFailures
+	if user != nil {
+		failures, err = app.models.LoginFailures.Get(user.ID)
+	} else {
+		failures, err = app.models.LoginFailures.GetForEmail(input.Email)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if failures.Locked(time.Now()) {
+		app.logSecurityEvent(r, "login_locked", user)
+		app.accountLockedResponse(w, r)
+		return
+	}
+
+	if failures.Count > 0 {
+		next := failures.LastFailureAt.Add(backoffDelay(app.config.limiter.login.backoff, app.config.limiter.login.backoffMax, failures.Count))
+
+		if wait := time.Until(next); wait > 0 {
+			app.logSecurityEvent(r, "login_throttled", user)
+			app.tooManyLoginAttemptsResponse(w, r, wait)
+			return
+		}
+	}
+
+	if user == nil {
+		app.recordLoginFailure(w, r, input.Email, nil)
+		return
+	}
+
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !match {
+		app.recordLoginFailure(w, r, input.Email, user)
+		return
+	}
+
+	if failures.Count > 0 {
+		err = app.models.LoginFailures.Reset(user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	// The plaintext password is only known at login, so take the chance to upgrade a hash created with
+	// bcrypt or outdated argon2id parameters.
+	if user.Password.NeedsRehash() {
+		err = app.rehashPassword(user, input.Password)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	app.logIn(w, r, user)
+}
+
+// The rehashPassword() helper replaces the stored hash of a user's password with one using the current
+// algorithm and parameters. Losing a race against another update of the user isn't an error, as the
+// password will be rehashed on a later login.
+func (app *application) rehashPassword(user *data.User, plaintext string) error {
+	err := user.Password.Set(plaintext)
+	if err != nil {
+		return err
+	}
+
+	err = app.models.Users.Update(user)
+	if err != nil && !errors.Is(err, data.ErrEditConflict) {
+		return err
+	}
+
+	return nil
+}
+
+func (app *application) refreshAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTokenPlaintext(v, input.RefreshToken); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	access, refresh, err := app.models.Tokens.Rotate(input.RefreshToken, app.opaqueAccessTokenTTL(), app.config.auth.refreshTokenTTL, realip.FromRequest(r), app.userAgent(r))
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrTokenReused):
+			// A rotated refresh token was replayed, so the session has been revoked. Log it, as it most
+			// likely means the token was stolen.
+			app.logger.PrintInfo("refresh token reused, session revoked", map[string]string{
+				"ip":         realip.FromRequest(r),
+				"user_agent": app.userAgent(r),
+			})
+			app.invalidCredentialsResponse(w, r)
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.invalidCredentialsResponse(w, r)
 		default:
@@ -43,24 +171,367 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
-	match, err := user.Password.Matches(input.Password)
+	if access == nil {
+		// The user's activation state and permissions may have changed since the last token was signed,
+		// so read them afresh.
+		user, err := app.models.Users.Get(refresh.UserID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		access, err = app.signAccessToken(user, refresh.Family)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": access, "refresh_token": refresh}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The logIn() helper is called once a user's first factor has been checked. Users with two-factor
+// authentication enabled are sent a short-lived challenge token, to be exchanged together with a code
+// at POST /v1/tokens/two-factor. Everyone else gets a session straight away.
+func (app *application) logIn(w http.ResponseWriter, r *http.Request, user *data.User) {
+	twoFactor, err := app.models.TwoFactor.Get(user.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if twoFactor == nil || !twoFactor.Enabled {
+		app.createSession(w, r, user)
+		return
+	}
+
+	challenge, err := app.models.Tokens.New(user.ID, 5*time.Minute, data.ScopeTwoFactor)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	if !match {
-		app.invalidCredentialsResponse(w, r)
+	err = app.writeJSON(w, http.StatusCreated, envelope{"challenge_token": challenge}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The createSession() helper logs a user in once all their credentials have been checked. It issues a
+// short-lived authentication token and a refresh token, and sends them to the client in a 201 Created
+// response.
+func (app *application) createSession(w http.ResponseWriter, r *http.Request, user *data.User) {
+	access, refresh, err := app.models.Tokens.NewSession(user.ID, app.opaqueAccessTokenTTL(), app.config.auth.refreshTokenTTL, realip.FromRequest(r), app.userAgent(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	if access == nil {
+		access, err = app.signAccessToken(user, refresh.Family)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": access, "refresh_token": refresh}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The opaqueAccessTokenTTL() helper returns the lifetime of the authentication tokens to store alongside
+// new refresh tokens. In signed mode no authentication token is stored, so it returns zero.
+func (app *application) opaqueAccessTokenTTL() time.Duration {
+	if app.config.auth.tokenMode == "signed" {
+		return 0
+	}
+
+	return app.config.auth.accessTokenTTL
+}
+
+// The signAccessToken() helper issues a signed authentication token for a user, belonging to the given
+// token family. The user's permissions are embedded in it, so changes to them only take effect for
+// signed tokens issued afterwards, unless the change revokes the user's signed tokens. The user's token
+// generation is embedded for that purpose.
+func (app *application) signAccessToken(user *data.User, family string) (*data.Token, error) {
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	generation, err := app.models.Users.GetTokenGeneration(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expiry := now.Add(app.config.auth.accessTokenTTL)
+
+	plaintext, err := app.keyring.Sign(signedtoken.Claims{
+		UserID:      user.ID,
+		Activated:   user.Activated,
+		Permissions: permissions,
+		Family:      family,
+		Generation:  generation,
+		IssuedAt:    now.Unix(),
+		Expiry:      expiry.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &data.Token{Plaintext: plaintext, UserID: user.ID, Expiry: expiry, Scope: data.ScopeAuthentication}, nil
+}
+
+func (app *application) deleteAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	// Revoke the token which was used to authenticate this request, along with its refresh token. A signed
+	// token can't be revoked on its own, so every signed token of the user is; the user's other sessions
+	// get new ones when they are refreshed.
+	var err error
+
+	if claims := app.contextGetClaims(r); claims != nil {
+		err = app.models.Tokens.RevokeFamily(claims.UserID, claims.Family)
+		if err == nil {
+			err = app.models.Users.RevokeSignedTokens(claims.UserID)
+		}
+	} else {
+		err = app.models.Tokens.RevokeSession(app.contextGetToken(r))
+	}
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "you have been successfully logged out"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	message := "if an activated account with that email address exists, an email will be sent to it containing password reset instructions"
+
+	app.emailAccount(w, r, input.Email, message, func(user *data.User) error {
+		// Only activated accounts can reset their password.
+		if !user.Activated {
+			return nil
+		}
+
+		return app.sendPasswordResetEmail(user)
+	})
+}
+
+// The sendPasswordResetEmail() helper creates a password reset token for a user and emails it to them.
+func (app *application) sendPasswordResetEmail(user *data.User) error {
+	token, err := app.models.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	data := map[string]interface{}{
+		"passwordResetToken": token.Plaintext,
+	}
+
+	return app.mailer.Send(user.Email, "token_password_reset.tmpl", data)
+}
+
+// The createMagicLinkTokenHandler() emails a one-time login link to the owner of an account, which can be
+// exchanged for a session at PUT /v1/tokens/magic-link without a password.
+func (app *application) createMagicLinkTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	message := "if an account with that email address exists, an email will be sent to it containing a login link"
+
+	app.emailAccount(w, r, input.Email, message, func(user *data.User) error {
+		// Only the most recently sent link should work, so remove any older ones first.
+		err := app.models.Tokens.DeleteAllForUser(data.ScopeMagicLink, user.ID)
+		if err != nil {
+			return err
+		}
+
+		token, err := app.models.Tokens.New(user.ID, app.config.auth.magicLinkTTL, data.ScopeMagicLink)
+		if err != nil {
+			return err
+		}
+
+		data := map[string]interface{}{
+			"magicLinkToken": token.Plaintext,
+			"expiry":         app.config.auth.magicLinkTTL.String(),
+			"loginURL":       "",
+		}
+
+		if app.config.auth.magicLinkURL != "" {
+			data["loginURL"] = app.config.auth.magicLinkURL + "?token=" + url.QueryEscape(token.Plaintext)
+		}
+
+		return app.mailer.Send(user.Email, "token_magic_link.tmpl", data)
+	})
+}
+
+// The exchangeMagicLinkTokenHandler() logs in the user a magic link was sent to. Users with two-factor
+// authentication enabled still have to provide a code.
+func (app *application) exchangeMagicLinkTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The token is consumed before logging in, so that concurrent requests with the same link can't each
+	// start a session.
+	userID, err := app.models.Tokens.Consume(data.ScopeMagicLink, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired login token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The user may have been deleted since the token was consumed.
+	user, err := app.models.Users.Get(userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired login token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeMagicLink, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.logIn(w, r, user)
+}
+
+func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	message := "if an account with that email address exists and is not yet activated, an email will be sent to it containing activation instructions"
+
+	app.emailAccount(w, r, input.Email, message, func(user *data.User) error {
+		if user.Activated {
+			return nil
+		}
+
+		// Only the most recently sent activation token should work, so remove any older ones first.
+		err := app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+		if err != nil {
+			return err
+		}
+
+		token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+		if err != nil {
+			return err
+		}
+
+		data := map[string]interface{}{
+			"activationToken": token.Plaintext,
+		}
+
+		return app.mailer.Send(user.Email, "token_activation.tmpl", data)
+	})
+}
+
+// The emailAccount() helper holds the behaviour shared by the endpoints which email a token to the owner
+// of an account. Requests are rate limited per email address. The account is then looked up and the task
+// run in a background goroutine, and the same 202 Accepted response carrying message is sent whether or
+// not a matching account exists, so that neither the response nor its timing reveals which email
+// addresses are registered.
+func (app *application) emailAccount(w http.ResponseWriter, r *http.Request, email, message string, task func(user *data.User) error) {
+	if app.config.limiter.enabled && !app.emailLimiter.allow(email) {
+		app.rateLimitExceededResponse(w, r)
+		return
+	}
+
+	app.background(func() {
+		user, err := app.models.Users.GetByEmail(email)
+		if err != nil {
+			if !errors.Is(err, data.ErrRecordNotFound) {
+				app.logger.PrintError(err, nil)
+			}
+			return
+		}
+
+		err = task(user)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	err := app.writeJSON(w, http.StatusAccepted, envelope{"message": message}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
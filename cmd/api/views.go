@@ -0,0 +1,83 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// The viewCounter type buffers movie view counts in memory, so that showMovieHandler doesn't have to
+// write to the database on every request. The counts are flushed to the movie_views table in batches.
+type viewCounter struct {
+	mux    sync.Mutex
+	counts map[int64]int64
+}
+
+func newViewCounter() *viewCounter {
+	return &viewCounter{counts: make(map[int64]int64)}
+}
+
+// Increment the buffered count for a movie, and return the number of movies currently buffered.
+func (c *viewCounter) add(movieID int64) int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.counts[movieID]++
+	return len(c.counts)
+}
+
+// Return the buffered counts and reset the buffer.
+func (c *viewCounter) drain() map[int64]int64 {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	counts := c.counts
+	c.counts = make(map[int64]int64)
+	return counts
+}
+
+// The recordMovieView() helper counts a view of a movie, flushing the buffer early if it has grown
+// to the configured batch size.
+func (app *application) recordMovieView(movieID int64) {
+	if app.views.add(movieID) >= app.config.views.batchSize {
+		app.flushMovieViews()
+	}
+}
+
+// The flushMovieViews() helper writes the buffered view counts to the database in a background task.
+func (app *application) flushMovieViews() {
+	counts := app.views.drain()
+	if len(counts) == 0 {
+		return
+	}
+
+	app.background(func() {
+		err := app.models.MovieViews.Record(counts)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+}
+
+// The startViewFlusher() helper starts a goroutine which flushes the buffered view counts at the
+// configured interval, and one last time when the server shuts down. The goroutine is tracked by the
+// application wait group, so that the final flush completes before the application exits.
+func (app *application) startViewFlusher() {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		ticker := time.NewTicker(app.config.views.flushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				app.flushMovieViews()
+			case <-app.shutdown:
+				app.flushMovieViews()
+				return
+			}
+		}
+	}()
+}
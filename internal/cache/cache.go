@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type entry[V any] struct {
+	value  V
+	expiry time.Time
+}
+
+// Cache is an in-memory key/value store whose entries expire a fixed time after they are set. It
+// is safe for concurrent use.
+type Cache[K comparable, V any] struct {
+	ttl        time.Duration
+	maxEntries int
+	mux        sync.Mutex
+	entries    map[K]entry[V]
+	hits       atomic.Int64
+	misses     atomic.Int64
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+// Return a new cache instance which keeps entries for the given time-to-live, and start a background
+// goroutine which periodically removes expired entries. If maxEntries is positive, the cache holds at
+// most that many entries, evicting the oldest ones to make room for new ones. Call Close to stop the
+// goroutine once the cache is no longer needed.
+func New[K comparable, V any](ttl time.Duration, maxEntries int) *Cache[K, V] {
+	c := &Cache[K, V]{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[K]entry[V]),
+		done:       make(chan struct{}),
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				c.removeExpired()
+			case <-c.done:
+				return
+			}
+		}
+	}()
+
+	return c
+}
+
+// Close stops the goroutine removing expired entries. The cache remains usable.
+func (c *Cache[K, V]) Close() {
+	c.closeOnce.Do(func() { close(c.done) })
+}
+
+// Get returns the value stored for key, and whether a live entry was found.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mux.Lock()
+	e, found := c.entries[key]
+	c.mux.Unlock()
+
+	if !found || time.Now().After(e.expiry) {
+		c.misses.Add(1)
+		var zero V
+		return zero, false
+	}
+
+	c.hits.Add(1)
+	return e.value, true
+}
+
+// Set stores value for key, replacing any existing entry.
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if _, found := c.entries[key]; !found && c.maxEntries > 0 && len(c.entries) >= c.maxEntries {
+		c.evictOldest()
+	}
+
+	c.entries[key] = entry[V]{value: value, expiry: time.Now().Add(c.ttl)}
+}
+
+// Delete removes the entry for key, if there is one.
+func (c *Cache[K, V]) Delete(key K) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	delete(c.entries, key)
+}
+
+// Clear removes all entries.
+func (c *Cache[K, V]) Clear() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.entries = make(map[K]entry[V])
+}
+
+// Hits returns the number of Get calls which found a live entry.
+func (c *Cache[K, V]) Hits() int64 {
+	return c.hits.Load()
+}
+
+// Misses returns the number of Get calls which found no entry, or an expired one.
+func (c *Cache[K, V]) Misses() int64 {
+	return c.misses.Load()
+}
+
+func (c *Cache[K, V]) removeExpired() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	now := time.Now()
+	for key, e := range c.entries {
+		if now.After(e.expiry) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Every entry has the same time-to-live, so the entry expiring first is the oldest one. The caller must
+// hold the mutex.
+func (c *Cache[K, V]) evictOldest() {
+	var (
+		oldest K
+		expiry time.Time
+		found  bool
+	)
+
+	for key, e := range c.entries {
+		if !found || e.expiry.Before(expiry) {
+			oldest, expiry, found = key, e.expiry, true
+		}
+	}
+
+	if found {
+		delete(c.entries, oldest)
+	}
+}
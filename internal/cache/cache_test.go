@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"greenlight.sparkyvxcx.co/internal/assert"
+)
+
+func TestCache(t *testing.T) {
+	t.Run("Returns stored values", func(t *testing.T) {
+		c := New[string, int](time.Minute, 0)
+
+		c.Set("a", 1)
+
+		value, found := c.Get("a")
+		assert.Equal(t, found, true)
+		assert.Equal(t, value, 1)
+		assert.Equal(t, c.Hits(), int64(1))
+	})
+
+	t.Run("Expired entries are misses", func(t *testing.T) {
+		c := New[string, int](-time.Second, 0)
+
+		c.Set("a", 1)
+
+		_, found := c.Get("a")
+		assert.Equal(t, found, false)
+		assert.Equal(t, c.Misses(), int64(1))
+	})
+
+	t.Run("Deleted entries are misses", func(t *testing.T) {
+		c := New[string, int](time.Minute, 0)
+
+		c.Set("a", 1)
+		c.Set("b", 2)
+		c.Delete("a")
+
+		_, found := c.Get("a")
+		assert.Equal(t, found, false)
+
+		c.Clear()
+
+		_, found = c.Get("b")
+		assert.Equal(t, found, false)
+	})
+	t.Run("Oldest entries are evicted when full", func(t *testing.T) {
+		c := New[string, int](time.Minute, 2)
+		defer c.Close()
+
+		c.Set("a", 1)
+		time.Sleep(time.Millisecond)
+		c.Set("b", 2)
+		c.Set("b", 3)
+		c.Set("c", 4)
+
+		_, found := c.Get("a")
+		assert.Equal(t, found, false)
+
+		value, found := c.Get("b")
+		assert.Equal(t, found, true)
+		assert.Equal(t, value, 3)
+
+		_, found = c.Get("c")
+		assert.Equal(t, found, true)
+	})
+
+	t.Run("Closed caches remain usable", func(t *testing.T) {
+		c := New[string, int](time.Minute, 0)
+
+		c.Close()
+		c.Close()
+
+		c.Set("a", 1)
+
+		_, found := c.Get("a")
+		assert.Equal(t, found, true)
+	})
+}
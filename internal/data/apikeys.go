@@ -0,0 +1,267 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"greenlight.sparkyvxcx.co/internal/validator"
+
+	"github.com/lib/pq"
+)
+
+// APIKeyPrefix starts every API key, so that keys are easy to tell apart from authentication tokens, and
+// easy to spot by secret scanners.
+const APIKeyPrefix = "greenlight_"
+
+// APIKey is a long-lived credential for machine-to-machine clients. It acts on behalf of its owner, but
+// only with the permissions listed in its scopes.
+type APIKey struct {
+	ID         int64       `json:"id"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UserID     int64       `json:"-"`
+	Name       string      `json:"name"`
+	Plaintext  string      `json:"key,omitempty"`
+	Hash       []byte      `json:"-"`
+	Hint       string      `json:"hint"`
+	Expiry     *time.Time  `json:"expiry"`
+	LastUsedAt *time.Time  `json:"last_used_at"`
+	Scopes     Permissions `json:"scopes"`
+}
+
+// Report whether a bearer token is an API key rather than an authentication token.
+func IsAPIKey(plaintext string) bool {
+	return strings.HasPrefix(plaintext, APIKeyPrefix)
+}
+
+func ValidateAPIKey(v *validator.Validator, key *APIKey) {
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	v.Check(len(key.Scopes) >= 1, "scopes", "must contain at least 1 permission")
+	v.Check(validator.Unique(key.Scopes), "scopes", "must not contain duplicate values")
+
+	if key.Expiry != nil {
+		v.Check(key.Expiry.After(time.Now()), "expiry", "must be in the future")
+	}
+}
+
+// Generate the plaintext, hash and hint of a new API key. The hint is the start of the key, which is
+// enough for its owner to recognise it without revealing it.
+func generateAPIKey(key *APIKey) error {
+	randomBytes := make([]byte, 32)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return err
+	}
+
+	key.Plaintext = APIKeyPrefix + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+
+	hash := sha256.Sum256([]byte(key.Plaintext))
+	key.Hash = hash[:]
+
+	key.Hint = key.Plaintext[:len(APIKeyPrefix)+4]
+
+	return nil
+}
+
+type APIKeyModel struct {
+	DB *sql.DB
+}
+
+// Insert() generates a new API key and stores it together with its scopes. The plaintext key is only
+// available on the returned struct, as just its hash is stored.
+func (m APIKeyModel) Insert(key *APIKey) error {
+	err := generateAPIKey(key)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO api_keys (user_id, name, hint, hash, expiry)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at
+	`
+
+	args := []interface{}{key.UserID, key.Name, key.Hint, key.Hash, key.Expiry}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	query = `
+	INSERT INTO api_keys_permissions
+	SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+	`
+
+	_, err = tx.ExecContext(ctx, query, key.ID, pq.Array(key.Scopes))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetForKey() returns the unexpired API key matching a plaintext key, with its scopes.
+func (m APIKeyModel) GetForKey(plaintext string) (*APIKey, error) {
+	hash := sha256.Sum256([]byte(plaintext))
+
+	query := `
+	SELECT api_keys.id, api_keys.created_at, api_keys.user_id, api_keys.name, api_keys.hint,
+		api_keys.expiry, api_keys.last_used_at,
+		array_remove(array_agg(permissions.code ORDER BY permissions.code), NULL)
+	FROM api_keys
+	LEFT JOIN api_keys_permissions ON api_keys_permissions.api_key_id = api_keys.id
+	LEFT JOIN permissions ON permissions.id = api_keys_permissions.permission_id
+	WHERE api_keys.hash = $1 AND (api_keys.expiry IS NULL OR api_keys.expiry > NOW())
+	GROUP BY api_keys.id
+	`
+
+	var key APIKey
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, hash[:]).Scan(
+		&key.ID,
+		&key.CreatedAt,
+		&key.UserID,
+		&key.Name,
+		&key.Hint,
+		&key.Expiry,
+		&key.LastUsedAt,
+		pq.Array(&key.Scopes),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &key, nil
+}
+
+// GetAllForUser() returns the API keys of a user, most recent first. Expired keys are included, so that
+// their owner can see why a client stopped working.
+func (m APIKeyModel) GetAllForUser(userID int64) ([]*APIKey, error) {
+	query := `
+	SELECT api_keys.id, api_keys.created_at, api_keys.user_id, api_keys.name, api_keys.hint,
+		api_keys.expiry, api_keys.last_used_at,
+		array_remove(array_agg(permissions.code ORDER BY permissions.code), NULL)
+	FROM api_keys
+	LEFT JOIN api_keys_permissions ON api_keys_permissions.api_key_id = api_keys.id
+	LEFT JOIN permissions ON permissions.id = api_keys_permissions.permission_id
+	WHERE api_keys.user_id = $1
+	GROUP BY api_keys.id
+	ORDER BY api_keys.created_at DESC, api_keys.id DESC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+
+	for rows.Next() {
+		var key APIKey
+
+		err := rows.Scan(
+			&key.ID,
+			&key.CreatedAt,
+			&key.UserID,
+			&key.Name,
+			&key.Hint,
+			&key.Expiry,
+			&key.LastUsedAt,
+			pq.Array(&key.Scopes),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, &key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Delete() revokes one of a user's API keys.
+func (m APIKeyModel) Delete(userID, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `DELETE FROM api_keys WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Touch() records that an API key has just been used. Like TokenModel.Touch(), it only writes if the
+// timestamp is more than a minute old.
+func (m APIKeyModel) Touch(id int64) error {
+	query := `
+	UPDATE api_keys SET last_used_at = NOW()
+	WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+// DeleteAllForUser() revokes every API key of a user.
+func (m APIKeyModel) DeleteAllForUser(userID int64) error {
+	query := `DELETE FROM api_keys WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
@@ -0,0 +1,48 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"greenlight.sparkyvxcx.co/internal/assert"
+	"greenlight.sparkyvxcx.co/internal/validator"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	var key APIKey
+
+	err := generateAPIKey(&key)
+	assert.NilError(t, err)
+
+	assert.Equal(t, IsAPIKey(key.Plaintext), true)
+	assert.Equal(t, len(key.Hash), 32)
+	assert.Equal(t, key.Hint, key.Plaintext[:len(APIKeyPrefix)+4])
+}
+
+func TestValidateAPIKey(t *testing.T) {
+	t.Run("Valid API key should pass", func(t *testing.T) {
+		v := validator.New()
+		expiry := time.Now().Add(time.Hour)
+
+		ValidateAPIKey(v, &APIKey{Name: "nightly import", Scopes: Permissions{"movies:read"}, Expiry: &expiry})
+
+		assert.Equal(t, v.Valid(), true)
+	})
+
+	t.Run("API key without scopes should fail", func(t *testing.T) {
+		v := validator.New()
+
+		ValidateAPIKey(v, &APIKey{Name: "nightly import"})
+
+		assert.Equal(t, v.Errors["scopes"], "must contain at least 1 permission")
+	})
+
+	t.Run("API key expiring in the past should fail", func(t *testing.T) {
+		v := validator.New()
+		expiry := time.Now().Add(-time.Hour)
+
+		ValidateAPIKey(v, &APIKey{Name: "nightly import", Scopes: Permissions{"movies:read"}, Expiry: &expiry})
+
+		assert.Equal(t, v.Errors["expiry"], "must be in the future")
+	})
+}
@@ -0,0 +1,160 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strings"
+	"time"
+
+	"greenlight.sparkyvxcx.co/internal/validator"
+)
+
+// Ceremonies are identified by a short slug, such as "oscars" or "cannes", which is used in URLs.
+var CeremonyRX = regexp.MustCompile("^[a-z0-9]+(?:-[a-z0-9]+)*$")
+
+type Award struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"-"`
+	Ceremony  string    `json:"ceremony"`
+	Year      int32     `json:"year"`
+	Category  string    `json:"category"`
+	Nominee   string    `json:"nominee"`
+	MovieID   *int64    `json:"movie_id,omitempty"`
+	Won       bool      `json:"won"`
+	Version   int32     `json:"version"`
+}
+
+func ValidateCeremony(v *validator.Validator, ceremony string) {
+	v.Check(ceremony != "", "ceremony", "must be provided")
+	v.Check(len(ceremony) <= 100, "ceremony", "must not be more than 100 bytes long")
+	v.Check(validator.Matches(ceremony, CeremonyRX), "ceremony", "must only contain lowercase letters, digits and hyphens")
+}
+
+func ValidateAward(v *validator.Validator, award *Award) {
+	ValidateCeremony(v, award.Ceremony)
+
+	v.Check(award.Year != 0, "year", "must be provided")
+	v.Check(award.Year >= 1888, "year", "must be greater than or equal to 1888")
+	v.Check(award.Year <= int32(time.Now().Year()), "year", "must not be in the future")
+
+	v.Check(award.Category != "", "category", "must be provided")
+	v.Check(len(award.Category) <= 500, "category", "must not be more than 500 bytes long")
+
+	v.Check(award.Nominee != "", "nominee", "must be provided")
+	v.Check(len(award.Nominee) <= 500, "nominee", "must not be more than 500 bytes long")
+
+	if award.MovieID != nil {
+		v.Check(*award.MovieID > 0, "movie_id", "must be a positive integer")
+	}
+}
+
+type AwardModel struct {
+	DB *sql.DB
+}
+
+// Import() inserts a batch of awards in a single transaction. A nomination which already exists (the
+// same ceremony, year, category and nominee) is updated in place, so re-importing a corrected data
+// set is safe. If any award refers to a movie which doesn't exist, nothing is imported and
+// ErrRecordNotFound is returned.
+func (m AwardModel) Import(awards []*Award) error {
+	query := `
+	INSERT INTO awards (ceremony, year, category, nominee, movie_id, won)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT ON CONSTRAINT awards_nomination_key
+	DO UPDATE SET movie_id = EXCLUDED.movie_id, won = EXCLUDED.won, version = awards.version + 1
+	RETURNING id, created_at, version
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, award := range awards {
+		args := []interface{}{award.Ceremony, award.Year, award.Category, award.Nominee, award.MovieID, award.Won}
+
+		err := stmt.QueryRowContext(ctx, args...).Scan(&award.ID, &award.CreatedAt, &award.Version)
+		if err != nil {
+			switch {
+			case strings.HasPrefix(err.Error(), `pq: insert or update on table "awards" violates foreign key constraint`):
+				return ErrRecordNotFound
+			default:
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetAllForMovie() returns the nominations of a movie, most recent first.
+func (m AwardModel) GetAllForMovie(movieID int64) ([]*Award, error) {
+	query := `
+	SELECT id, created_at, ceremony, year, category, nominee, movie_id, won, version
+	FROM awards
+	WHERE movie_id = $1
+	ORDER BY year DESC, ceremony ASC, category ASC, id ASC`
+
+	return m.query(query, movieID)
+}
+
+// GetAllForCeremony() returns all the nominations of a ceremony in a given year.
+func (m AwardModel) GetAllForCeremony(ceremony string, year int32) ([]*Award, error) {
+	query := `
+	SELECT id, created_at, ceremony, year, category, nominee, movie_id, won, version
+	FROM awards
+	WHERE ceremony = $1 AND year = $2
+	ORDER BY category ASC, won DESC, nominee ASC, id ASC`
+
+	return m.query(query, ceremony, year)
+}
+
+func (m AwardModel) query(query string, args ...interface{}) ([]*Award, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	awards := []*Award{}
+
+	for rows.Next() {
+		var award Award
+
+		err := rows.Scan(
+			&award.ID,
+			&award.CreatedAt,
+			&award.Ceremony,
+			&award.Year,
+			&award.Category,
+			&award.Nominee,
+			&award.MovieID,
+			&award.Won,
+			&award.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		awards = append(awards, &award)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return awards, nil
+}
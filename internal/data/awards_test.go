@@ -0,0 +1,89 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"greenlight.sparkyvxcx.co/internal/assert"
+	"greenlight.sparkyvxcx.co/internal/validator"
+)
+
+func TestValidateAward(t *testing.T) {
+	movieID := int64(1)
+	invalidMovieID := int64(0)
+
+	tests := []struct {
+		name    string
+		award   Award
+		key     string
+		message string
+	}{
+		{
+			name:  "Valid Award Should Pass",
+			award: Award{Ceremony: "oscars", Year: 1973, Category: "Best Picture", Nominee: "The Godfather", MovieID: &movieID, Won: true},
+		},
+		{
+			name:  "First Year Should Pass",
+			award: Award{Ceremony: "oscars", Year: 1888, Category: "Best Picture", Nominee: "The Godfather"},
+		},
+		{
+			name:    "Missing Ceremony Should Fail",
+			award:   Award{Year: 1973, Category: "Best Picture", Nominee: "The Godfather"},
+			key:     "ceremony",
+			message: "must be provided",
+		},
+		{
+			name:    "Invalid Ceremony Should Fail",
+			award:   Award{Ceremony: "Academy Awards", Year: 1973, Category: "Best Picture", Nominee: "The Godfather"},
+			key:     "ceremony",
+			message: "must only contain lowercase letters, digits and hyphens",
+		},
+		{
+			name:    "Missing Year Should Fail",
+			award:   Award{Ceremony: "oscars", Category: "Best Picture", Nominee: "The Godfather"},
+			key:     "year",
+			message: "must be provided",
+		},
+		{
+			name:    "Early Year Should Fail",
+			award:   Award{Ceremony: "oscars", Year: 1887, Category: "Best Picture", Nominee: "The Godfather"},
+			key:     "year",
+			message: "must be greater than or equal to 1888",
+		},
+		{
+			name:    "Future Year Should Fail",
+			award:   Award{Ceremony: "oscars", Year: 9999, Category: "Best Picture", Nominee: "The Godfather"},
+			key:     "year",
+			message: "must not be in the future",
+		},
+		{
+			name:    "Missing Category Should Fail",
+			award:   Award{Ceremony: "oscars", Year: 1973, Nominee: "The Godfather"},
+			key:     "category",
+			message: "must be provided",
+		},
+		{
+			name:    "Long Nominee Should Fail",
+			award:   Award{Ceremony: "oscars", Year: 1973, Category: "Best Picture", Nominee: strings.Repeat("a", 501)},
+			key:     "nominee",
+			message: "must not be more than 500 bytes long",
+		},
+		{
+			name:    "Invalid Movie ID Should Fail",
+			award:   Award{Ceremony: "oscars", Year: 1973, Category: "Best Picture", Nominee: "The Godfather", MovieID: &invalidMovieID},
+			key:     "movie_id",
+			message: "must be a positive integer",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+
+			ValidateAward(v, &tt.award)
+
+			assert.Equal(t, v.Valid(), tt.key == "")
+			assert.Equal(t, v.Errors[tt.key], tt.message)
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrDuplicateCollaborator = errors.New("duplicate collaborator")
+)
+
+// MovieCollaborator is a user allowed to edit a movie they don't own.
+type MovieCollaborator struct {
+	UserID    int64     `json:"user_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type MovieCollaboratorModel struct {
+	DB *sql.DB
+}
+
+// Insert() makes a user a collaborator on a movie. ErrRecordNotFound is returned if the user doesn't
+// exist, and ErrDuplicateCollaborator if they already collaborate on the movie.
+func (m MovieCollaboratorModel) Insert(movieID, userID int64) error {
+	query := `
+	INSERT INTO movie_collaborators (movie_id, user_id)
+	VALUES ($1, $2)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, movieID, userID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "movie_collaborators_pkey"`:
+			return ErrDuplicateCollaborator
+		case err.Error() == `pq: insert or update on table "movie_collaborators" violates foreign key constraint "movie_collaborators_user_id_fkey"`:
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Exists() reports whether a user is a collaborator on a movie.
+func (m MovieCollaboratorModel) Exists(movieID, userID int64) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM movie_collaborators WHERE movie_id = $1 AND user_id = $2)`
+
+	var exists bool
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, movieID, userID).Scan(&exists)
+	return exists, err
+}
+
+func (m MovieCollaboratorModel) GetAllForMovie(movieID int64) ([]*MovieCollaborator, error) {
+	query := `
+	SELECT users.id, users.name, movie_collaborators.created_at
+	FROM movie_collaborators
+	INNER JOIN users ON users.id = movie_collaborators.user_id
+	WHERE movie_collaborators.movie_id = $1
+	ORDER BY movie_collaborators.created_at, users.id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collaborators := []*MovieCollaborator{}
+
+	for rows.Next() {
+		var collaborator MovieCollaborator
+
+		err := rows.Scan(&collaborator.UserID, &collaborator.Name, &collaborator.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		collaborators = append(collaborators, &collaborator)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return collaborators, nil
+}
+
+// GetMoviesForUser() returns every movie a user collaborates on. It's used for personal data exports, so it
+// isn't paginated.
+func (m MovieCollaboratorModel) GetMoviesForUser(userID int64) ([]*Movie, error) {
+	query := `
+	SELECT movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres,
+		movies.version, movies.created_by
+	FROM movie_collaborators
+	INNER JOIN movies ON movies.id = movie_collaborators.movie_id
+	WHERE movie_collaborators.user_id = $1
+	ORDER BY movies.id ASC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.CreatedBy,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		movies = append(movies, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return movies, nil
+}
+
+func (m MovieCollaboratorModel) Delete(movieID, userID int64) error {
+	query := `DELETE FROM movie_collaborators WHERE movie_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, movieID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
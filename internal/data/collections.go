@@ -0,0 +1,468 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"greenlight.sparkyvxcx.co/internal/validator"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrDuplicateCollectionMovie = errors.New("duplicate collection movie")
+	ErrCollectionOrderMismatch  = errors.New("collection order mismatch")
+)
+
+type Collection struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"-"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	OwnerID     *int64    `json:"owner_id,omitempty"`
+	Public      bool      `json:"public"`
+	Version     int32     `json:"version"`
+}
+
+// OwnedCollection is a collection together with the IDs of its movies, in collection order.
+type OwnedCollection struct {
+	Collection
+	MovieIDs []int64 `json:"movie_ids"`
+}
+
+// A collection without an owner is a curated collection, maintained by users holding the
+// movies:write permission rather than by a single user.
+func (c *Collection) IsCurated() bool {
+	return c.OwnerID == nil
+}
+
+// Check whether the collection is owned by the given user.
+func (c *Collection) IsOwnedBy(userID int64) bool {
+	return c.OwnerID != nil && *c.OwnerID == userID
+}
+
+// Check whether the given user is allowed to see the collection. Curated and public collections
+// are visible to everyone, private ones only to their owner.
+func (c *Collection) VisibleTo(userID int64) bool {
+	return c.IsCurated() || c.Public || c.IsOwnedBy(userID)
+}
+
+func ValidateCollection(v *validator.Validator, collection *Collection) {
+	v.Check(collection.Name != "", "name", "must be provided")
+	v.Check(len(collection.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(len(collection.Description) <= 5000, "description", "must not be more than 5000 bytes long")
+
+	// Curated collections are part of the catalog, so they can't be hidden.
+	if collection.IsCurated() {
+		v.Check(collection.Public, "public", "curated collections must be public")
+	}
+}
+
+type CollectionModel struct {
+	DB *sql.DB
+}
+
+func (m CollectionModel) Insert(collection *Collection) error {
+	query := `
+	INSERT INTO collections (name, description, owner_id, public)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at, version
+	`
+
+	args := []interface{}{collection.Name, collection.Description, collection.OwnerID, collection.Public}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&collection.ID, &collection.CreatedAt, &collection.Version)
+}
+
+func (m CollectionModel) Get(id int64) (*Collection, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT id, created_at, name, description, owner_id, public, version
+	FROM collections
+	WHERE id = $1
+	`
+
+	var collection Collection
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&collection.ID,
+		&collection.CreatedAt,
+		&collection.Name,
+		&collection.Description,
+		&collection.OwnerID,
+		&collection.Public,
+		&collection.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &collection, nil
+}
+
+func (m CollectionModel) Update(collection *Collection) error {
+	query := `
+	UPDATE collections
+	SET name = $1, description = $2, public = $3, version = version + 1
+	WHERE id = $4 AND version = $5
+	RETURNING version
+	`
+
+	args := []interface{}{
+		collection.Name,
+		collection.Description,
+		collection.Public,
+		collection.ID,
+		collection.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&collection.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m CollectionModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `DELETE FROM collections WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAll() returns the collections visible to the given user: curated and public collections,
+// plus any private collections the user owns.
+func (m CollectionModel) GetAll(userID int64, filters Filters) ([]*Collection, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, created_at, name, description, owner_id, public, version
+	FROM collections
+	WHERE owner_id IS NULL OR public OR owner_id = $1
+	ORDER BY %s %s, id ASC
+	LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	collections := []*Collection{}
+
+	for rows.Next() {
+		var collection Collection
+
+		err := rows.Scan(
+			&totalRecords,
+			&collection.ID,
+			&collection.CreatedAt,
+			&collection.Name,
+			&collection.Description,
+			&collection.OwnerID,
+			&collection.Public,
+			&collection.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		collections = append(collections, &collection)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return collections, metadata, nil
+}
+
+// GetMovies() returns a page of the movies in a collection. Sorting by "position" follows the
+// curated order of the collection.
+func (m CollectionModel) GetMovies(collectionID int64, filters Filters) ([]*Movie, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres, movies.version
+	FROM movies
+	INNER JOIN collections_movies ON collections_movies.movie_id = movies.id
+	WHERE collections_movies.collection_id = $1
+	ORDER BY %s %s, id ASC
+	LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, collectionID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&totalRecords,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		movies = append(movies, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return movies, metadata, nil
+}
+
+// AddMovie() inserts a movie into a collection at the given 1-based position, shifting the movies
+// at and after that position down by one. A position of 0, or one past the end of the collection,
+// appends the movie.
+func (m CollectionModel) AddMovie(collectionID, movieID int64, position int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the collection row so that concurrent membership changes are applied one at a time.
+	var last int
+	err = tx.QueryRowContext(ctx, `
+	SELECT COALESCE(max(position), 0)
+	FROM collections_movies
+	WHERE collection_id = (SELECT id FROM collections WHERE id = $1 FOR UPDATE)
+	`, collectionID).Scan(&last)
+	if err != nil {
+		return err
+	}
+
+	if position < 1 || position > last {
+		position = last + 1
+	} else {
+		_, err = tx.ExecContext(ctx, `
+		UPDATE collections_movies SET position = position + 1
+		WHERE collection_id = $1 AND position >= $2
+		`, collectionID, position)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO collections_movies (collection_id, movie_id, position)
+	VALUES ($1, $2, $3)
+	`, collectionID, movieID, position)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "collections_movies_pkey"`:
+			return ErrDuplicateCollectionMovie
+		case err.Error() == `pq: insert or update on table "collections_movies" violates foreign key constraint "collections_movies_movie_id_fkey"`:
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RemoveMovie() removes a movie from a collection and closes the gap it leaves in the ordering.
+func (m CollectionModel) RemoveMovie(collectionID, movieID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var position int
+	err = tx.QueryRowContext(ctx, `
+	DELETE FROM collections_movies
+	WHERE collection_id = $1 AND movie_id = $2
+	RETURNING position
+	`, collectionID, movieID).Scan(&position)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE collections_movies SET position = position - 1
+	WHERE collection_id = $1 AND position > $2
+	`, collectionID, position)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Reorder() sets the order of a collection to the given list of movie IDs. The list must contain
+// every movie in the collection exactly once, otherwise ErrCollectionOrderMismatch is returned.
+func (m CollectionModel) Reorder(collectionID int64, movieIDs []int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRowContext(ctx, `
+	SELECT count(*)
+	FROM collections_movies
+	WHERE collection_id = (SELECT id FROM collections WHERE id = $1 FOR UPDATE)
+	`, collectionID).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count != len(movieIDs) {
+		return ErrCollectionOrderMismatch
+	}
+
+	result, err := tx.ExecContext(ctx, `
+	UPDATE collections_movies
+	SET position = ordered.position
+	FROM unnest($2::bigint[]) WITH ORDINALITY AS ordered(movie_id, position)
+	WHERE collections_movies.collection_id = $1 AND collections_movies.movie_id = ordered.movie_id
+	`, collectionID, pq.Array(movieIDs))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// Any ID that isn't in the collection (or a duplicate) leaves some rows untouched.
+	if int(rowsAffected) != count {
+		return ErrCollectionOrderMismatch
+	}
+
+	// The deferred unique (collection_id, position) constraint is checked here.
+	return tx.Commit()
+}
+
+// GetAllForOwner() returns every personal collection owned by a user, together with the IDs of their
+// movies in order. It's used for personal data exports, so it isn't paginated.
+func (m CollectionModel) GetAllForOwner(ownerID int64) ([]*OwnedCollection, error) {
+	query := `
+	SELECT collections.id, collections.created_at, collections.name, collections.description,
+		collections.owner_id, collections.public, collections.version,
+		array_remove(array_agg(collections_movies.movie_id ORDER BY collections_movies.position), NULL)
+	FROM collections
+	LEFT JOIN collections_movies ON collections_movies.collection_id = collections.id
+	WHERE collections.owner_id = $1
+	GROUP BY collections.id
+	ORDER BY collections.id ASC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := []*OwnedCollection{}
+
+	for rows.Next() {
+		var collection OwnedCollection
+
+		err := rows.Scan(
+			&collection.ID,
+			&collection.CreatedAt,
+			&collection.Name,
+			&collection.Description,
+			&collection.OwnerID,
+			&collection.Public,
+			&collection.Version,
+			pq.Array(&collection.MovieIDs),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		collections = append(collections, &collection)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return collections, nil
+}
@@ -0,0 +1,86 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"greenlight.sparkyvxcx.co/internal/assert"
+	"greenlight.sparkyvxcx.co/internal/validator"
+)
+
+func TestValidateCollection(t *testing.T) {
+	ownerID := int64(1)
+
+	tests := []struct {
+		name       string
+		collection Collection
+		key        string
+		message    string
+	}{
+		{
+			name:       "Valid Private Collection Should Pass",
+			collection: Collection{Name: "Favourites", OwnerID: &ownerID},
+		},
+		{
+			name:       "Valid Curated Collection Should Pass",
+			collection: Collection{Name: "Classics", Description: "The classics of cinema", Public: true},
+		},
+		{
+			name:       "Missing Name Should Fail",
+			collection: Collection{OwnerID: &ownerID},
+			key:        "name",
+			message:    "must be provided",
+		},
+		{
+			name:       "Long Name Should Fail",
+			collection: Collection{Name: strings.Repeat("a", 501), OwnerID: &ownerID},
+			key:        "name",
+			message:    "must not be more than 500 bytes long",
+		},
+		{
+			name:       "Long Description Should Fail",
+			collection: Collection{Name: "Favourites", Description: strings.Repeat("a", 5001), OwnerID: &ownerID},
+			key:        "description",
+			message:    "must not be more than 5000 bytes long",
+		},
+		{
+			name:       "Private Curated Collection Should Fail",
+			collection: Collection{Name: "Classics"},
+			key:        "public",
+			message:    "curated collections must be public",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+
+			ValidateCollection(v, &tt.collection)
+
+			assert.Equal(t, v.Valid(), tt.key == "")
+			assert.Equal(t, v.Errors[tt.key], tt.message)
+		})
+	}
+}
+
+func TestCollectionVisibleTo(t *testing.T) {
+	ownerID := int64(1)
+
+	tests := []struct {
+		name       string
+		collection Collection
+		userID     int64
+		visible    bool
+	}{
+		{name: "Curated Collection Is Visible", collection: Collection{Public: true}, userID: 2, visible: true},
+		{name: "Public Collection Is Visible", collection: Collection{OwnerID: &ownerID, Public: true}, userID: 2, visible: true},
+		{name: "Private Collection Is Visible To Its Owner", collection: Collection{OwnerID: &ownerID}, userID: 1, visible: true},
+		{name: "Private Collection Is Hidden From Others", collection: Collection{OwnerID: &ownerID}, userID: 2, visible: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.collection.VisibleTo(tt.userID), tt.visible)
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type EmailChangeModel struct {
+	DB *sql.DB
+}
+
+// Set() records a pending email change for a user, replacing any earlier one.
+func (m EmailChangeModel) Set(userID int64, newEmail string) error {
+	query := `
+	INSERT INTO email_changes (user_id, new_email)
+	VALUES ($1, $2)
+	ON CONFLICT (user_id) DO UPDATE SET new_email = EXCLUDED.new_email, created_at = NOW()
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, newEmail)
+	return err
+}
+
+// Get() returns the new email address of a user's pending email change.
+func (m EmailChangeModel) Get(userID int64) (string, error) {
+	query := `SELECT new_email FROM email_changes WHERE user_id = $1`
+
+	var newEmail string
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&newEmail)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+
+	return newEmail, nil
+}
+
+func (m EmailChangeModel) Delete(userID int64) error {
+	query := `DELETE FROM email_changes WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
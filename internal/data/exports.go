@@ -0,0 +1,72 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type ExportModel struct {
+	DB *sql.DB
+}
+
+// Insert() stores a personal data export, and returns the token it can be downloaded with.
+func (m ExportModel) Insert(userID int64, archive []byte, ttl time.Duration) (*Token, error) {
+	token, err := generateToken(userID, ttl, "")
+	if err != nil {
+		return nil, err
+	}
+
+	query := `INSERT INTO data_exports (hash, user_id, expiry, archive) VALUES ($1, $2, $3, $4)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, token.Hash, userID, token.Expiry, archive)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// GetForToken() returns the archive of the unexpired export matching a download token.
+func (m ExportModel) GetForToken(tokenPlaintext string) ([]byte, error) {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `SELECT archive FROM data_exports WHERE hash = $1 AND expiry > NOW()`
+
+	var archive []byte
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, hash[:]).Scan(&archive)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return archive, nil
+}
+
+// DeleteExpired() removes the exports which can no longer be downloaded.
+func (m ExportModel) DeleteExpired() (int64, error) {
+	query := `DELETE FROM data_exports WHERE expiry <= NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
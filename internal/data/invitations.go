@@ -0,0 +1,197 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+
+	"greenlight.sparkyvxcx.co/internal/validator"
+
+	"github.com/lib/pq"
+)
+
+// Invitation lets the person it was sent to register, whatever the registration mode, with an activated
+// account holding the preset permissions.
+type Invitation struct {
+	ID          int64       `json:"id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	CreatedBy   *int64      `json:"created_by"`
+	Email       string      `json:"email"`
+	Permissions Permissions `json:"permissions"`
+	Expiry      time.Time   `json:"expiry"`
+}
+
+func ValidateInvitation(v *validator.Validator, invitation *Invitation) {
+	ValidateEmail(v, invitation.Email)
+
+	v.Check(len(invitation.Permissions) <= 20, "permissions", "must not contain more than 20 permissions")
+	v.Check(validator.Unique(invitation.Permissions), "permissions", "must not contain duplicate values")
+}
+
+type InvitationModel struct {
+	DB *sql.DB
+}
+
+// Insert() stores an invitation, and returns the token it can be redeemed with.
+func (m InvitationModel) Insert(invitation *Invitation, ttl time.Duration) (*Token, error) {
+	token, err := generateToken(0, ttl, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if invitation.Permissions == nil {
+		invitation.Permissions = Permissions{}
+	}
+
+	query := `
+	INSERT INTO invitations (hash, created_by, email, permissions, expiry)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at, expiry
+	`
+
+	args := []interface{}{token.Hash, invitation.CreatedBy, invitation.Email, pq.Array(invitation.Permissions), token.Expiry}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&invitation.ID, &invitation.CreatedAt, &invitation.Expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// GetForToken() returns the unexpired invitation matching a token.
+func (m InvitationModel) GetForToken(tokenPlaintext string) (*Invitation, error) {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+	SELECT id, created_at, created_by, email, permissions, expiry
+	FROM invitations
+	WHERE hash = $1 AND expiry > NOW()
+	`
+
+	var invitation Invitation
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, hash[:]).Scan(
+		&invitation.ID,
+		&invitation.CreatedAt,
+		&invitation.CreatedBy,
+		&invitation.Email,
+		pq.Array(&invitation.Permissions),
+		&invitation.Expiry,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &invitation, nil
+}
+
+// GetAll() returns the invitations which haven't been redeemed yet and are still valid, newest first.
+func (m InvitationModel) GetAll() ([]*Invitation, error) {
+	query := `
+	SELECT id, created_at, created_by, email, permissions, expiry
+	FROM invitations
+	WHERE expiry > NOW()
+	ORDER BY id DESC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []*Invitation{}
+
+	for rows.Next() {
+		var invitation Invitation
+
+		err := rows.Scan(
+			&invitation.ID,
+			&invitation.CreatedAt,
+			&invitation.CreatedBy,
+			&invitation.Email,
+			pq.Array(&invitation.Permissions),
+			&invitation.Expiry,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		invitations = append(invitations, &invitation)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+func (m InvitationModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `DELETE FROM invitations WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteAllForEmail() removes every invitation sent to an email address, once it has been registered.
+func (m InvitationModel) DeleteAllForEmail(email string) error {
+	query := `DELETE FROM invitations WHERE email = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, email)
+	return err
+}
+
+// DeleteExpired() removes the invitations which can no longer be redeemed.
+func (m InvitationModel) DeleteExpired() (int64, error) {
+	query := `DELETE FROM invitations WHERE expiry <= NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
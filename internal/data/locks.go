@@ -0,0 +1,53 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+)
+
+type LockModel struct {
+	DB *sql.DB
+}
+
+// TryAcquire() tries to take the session level Postgres advisory lock with the given key, without
+// waiting. Each instance of the application talks to the same database, so the lock can make sure a job
+// only runs in one of them at a time. If the lock is taken, the returned function releases it; it holds
+// on to a connection of the pool until then.
+func (m LockModel) TryAcquire(key int64) (release func(), acquired bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Advisory locks belong to a database session, so the lock and unlock queries must run on the same
+	// connection.
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&acquired)
+	if err != nil || !acquired {
+		conn.Close()
+		return nil, false, err
+	}
+
+	release = func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+
+		// Closing the connection returns it to the pool without ending the session, so unlock explicitly.
+		// If that fails, the session may still hold the lock, so the connection is discarded rather than
+		// returned to the pool: returning driver.ErrBadConn from Raw() makes database/sql close it, which
+		// ends the session and releases the lock.
+		_, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, key)
+		if err != nil {
+			conn.Raw(func(driverConn interface{}) error {
+				return driver.ErrBadConn
+			})
+		}
+		conn.Close()
+	}
+
+	return release, true, nil
+}
@@ -0,0 +1,178 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// LoginFailures holds the failed login attempts made against an account since its last successful login.
+type LoginFailures struct {
+	UserID        int64
+	Count         int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+
+	// JustLocked is set by RecordFailure() when the failure it recorded locked the account.
+	JustLocked bool
+}
+
+// Report whether the account is locked at the given time.
+func (f *LoginFailures) Locked(now time.Time) bool {
+	return f.LockedUntil != nil && f.LockedUntil.After(now)
+}
+
+type LoginFailureModel struct {
+	DB *sql.DB
+}
+
+// Get() returns the failed login attempts for an account. An account without any has a zero Count.
+func (m LoginFailureModel) Get(userID int64) (*LoginFailures, error) {
+	failures := LoginFailures{UserID: userID}
+
+	err := m.get("login_failures", "user_id", userID, &failures)
+	if err != nil {
+		return nil, err
+	}
+
+	return &failures, nil
+}
+
+// GetForEmail() returns the failed login attempts made with an email address that has no account.
+func (m LoginFailureModel) GetForEmail(email string) (*LoginFailures, error) {
+	var failures LoginFailures
+
+	err := m.get("unknown_login_failures", "email", email, &failures)
+	if err != nil {
+		return nil, err
+	}
+
+	return &failures, nil
+}
+
+func (m LoginFailureModel) get(table, keyColumn string, key interface{}, failures *LoginFailures) error {
+	query := fmt.Sprintf(`
+	SELECT failures, last_failure_at, locked_until
+	FROM %s
+	WHERE %s = $1
+	`, table, keyColumn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, key).Scan(&failures.Count, &failures.LastFailureAt, &failures.LockedUntil)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	return nil
+}
+
+// RecordFailure() counts a failed login attempt, and locks the account for the lockout duration once
+// maxFailures attempts have failed. Failures older than the lockout duration, and failures from before an
+// expired lockout, are forgotten, so the count starts again from one.
+func (m LoginFailureModel) RecordFailure(userID int64, maxFailures int, lockout time.Duration) (*LoginFailures, error) {
+	failures := LoginFailures{UserID: userID}
+
+	err := m.recordFailure("login_failures", "user_id", userID, maxFailures, lockout, &failures)
+	if err != nil {
+		return nil, err
+	}
+
+	return &failures, nil
+}
+
+// RecordFailureForEmail() counts a failed login attempt made with an email address that has no account,
+// exactly as RecordFailure() does for accounts.
+func (m LoginFailureModel) RecordFailureForEmail(email string, maxFailures int, lockout time.Duration) (*LoginFailures, error) {
+	var failures LoginFailures
+
+	err := m.recordFailure("unknown_login_failures", "email", email, maxFailures, lockout, &failures)
+	if err != nil {
+		return nil, err
+	}
+
+	return &failures, nil
+}
+
+// The count is updated in a single upsert, so concurrent failures are all counted even when no row exists
+// yet. The existing row is reset when its failures have expired, and kept locked while its lockout lasts.
+func (m LoginFailureModel) recordFailure(table, keyColumn string, key interface{}, maxFailures int, lockout time.Duration, failures *LoginFailures) error {
+	query := fmt.Sprintf(`
+	INSERT INTO %[1]s AS f (%[2]s, failures, last_failure_at, locked_until)
+	VALUES ($1, 1, $3, CASE WHEN $2 <= 1 THEN $5::timestamptz END)
+	ON CONFLICT (%[2]s) DO UPDATE
+	SET failures = CASE
+			WHEN f.last_failure_at < $4 OR f.locked_until <= $3 THEN 1
+			ELSE f.failures + 1
+		END,
+		last_failure_at = $3,
+		locked_until = CASE
+			WHEN f.last_failure_at < $4 OR f.locked_until <= $3 THEN
+				CASE WHEN $2 <= 1 THEN $5::timestamptz END
+			WHEN f.locked_until IS NOT NULL THEN f.locked_until
+			WHEN f.failures + 1 >= $2 THEN $5::timestamptz
+		END
+	RETURNING failures, last_failure_at, locked_until
+	`, table, keyColumn)
+
+	now := time.Now()
+	args := []interface{}{key, maxFailures, now, now.Add(-lockout), now.Add(lockout)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&failures.Count, &failures.LastFailureAt, &failures.LockedUntil)
+	if err != nil {
+		return err
+	}
+
+	// Updates of the row are serialised, so only the failure that reached maxFailures sees that count
+	// while the lockout lasts.
+	failures.JustLocked = failures.LockedUntil != nil && failures.Count == maxFailures
+
+	return nil
+}
+
+// DeleteStale() removes the failed logins that RecordFailure() would forget: those older than the lockout
+// duration, with no lockout still in effect.
+func (m LoginFailureModel) DeleteStale(lockout time.Duration) (int64, error) {
+	var total int64
+
+	for _, table := range []string{"login_failures", "unknown_login_failures"} {
+		query := fmt.Sprintf(`
+		DELETE FROM %s
+		WHERE last_failure_at < $1
+		AND (locked_until IS NULL OR locked_until <= NOW())
+		`, table)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		result, err := m.DB.ExecContext(ctx, query, time.Now().Add(-lockout))
+		cancel()
+		if err != nil {
+			return total, err
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+
+		total += n
+	}
+
+	return total, nil
+}
+
+// Reset() clears the failed login attempts for an account, unlocking it.
+func (m LoginFailureModel) Reset(userID int64) error {
+	query := `DELETE FROM login_failures WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	return err
+}
@@ -17,31 +17,165 @@ type Models struct {
 		Get(id int64) (*Movie, error)
 		Update(movie *Movie) error
 		Delete(id int64) error
-		GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error)
+		GetAll(title string, genres []string, wonAward *bool, filters Filters) ([]*Movie, Metadata, error)
+		GetStats(title string, genres []string) (*MovieStats, error)
+		Suggest(prefix string, limit int) ([]*MovieSuggestion, error)
+		GetAllCreatedBy(userID int64) ([]*Movie, error)
+	}
+	MovieCollaborators interface {
+		Insert(movieID, userID int64) error
+		Exists(movieID, userID int64) (bool, error)
+		GetAllForMovie(movieID int64) ([]*MovieCollaborator, error)
+		GetMoviesForUser(userID int64) ([]*Movie, error)
+		Delete(movieID, userID int64) error
+	}
+	MovieViews interface {
+		Record(counts map[int64]int64) error
+		GetTrending(days int, limit int) ([]*TrendingMovie, error)
+	}
+	Awards interface {
+		Import(awards []*Award) error
+		GetAllForMovie(movieID int64) ([]*Award, error)
+		GetAllForCeremony(ceremony string, year int32) ([]*Award, error)
+	}
+	Collections interface {
+		Insert(collection *Collection) error
+		Get(id int64) (*Collection, error)
+		Update(collection *Collection) error
+		Delete(id int64) error
+		GetAll(userID int64, filters Filters) ([]*Collection, Metadata, error)
+		GetMovies(collectionID int64, filters Filters) ([]*Movie, Metadata, error)
+		AddMovie(collectionID, movieID int64, position int) error
+		RemoveMovie(collectionID, movieID int64) error
+		Reorder(collectionID int64, movieIDs []int64) error
+		GetAllForOwner(ownerID int64) ([]*OwnedCollection, error)
 	}
 	Permissions interface {
 		GetAllForUser(userID int64) (Permissions, error)
 		AddForUser(userID int64, codes ...string) error
+		RemoveForUser(userID int64, codes ...string) error
+		GetAll() (Permissions, error)
+	}
+	Roles interface {
+		GetAll() ([]*Role, error)
+		GetAllForUser(userID int64) ([]string, error)
+		AddForUser(userID int64, names ...string) error
+		RemoveForUser(userID int64, names ...string) error
+	}
+	Groups interface {
+		Insert(group *Group) error
+		Get(id int64) (*Group, error)
+		GetAll() ([]*Group, error)
+		GetAllForUser(userID int64) ([]*Group, error)
+		Delete(id int64) error
+		AddMembers(groupID int64, userIDs ...int64) error
+		RemoveMembers(groupID int64, userIDs ...int64) error
+		AddRoles(groupID int64, names ...string) error
+		RemoveRoles(groupID int64, names ...string) error
+	}
+	Invitations interface {
+		Insert(invitation *Invitation, ttl time.Duration) (*Token, error)
+		GetForToken(tokenPlaintext string) (*Invitation, error)
+		GetAll() ([]*Invitation, error)
+		Delete(id int64) error
+		DeleteAllForEmail(email string) error
+		DeleteExpired() (int64, error)
 	}
 	Users interface {
 		Insert(user *User) error
+		Get(id int64) (*User, error)
 		GetByEmail(email string) (*User, error)
 		Update(user *User) error
 		GetForToken(scope string, token string) (*User, error)
+		ScheduleDeletion(userID int64, at time.Time) error
+		GetTokenGeneration(userID int64) (int32, error)
+		RevokeSignedTokens(userIDs ...int64) error
+		RevokeSignedTokensForGroup(groupID int64) error
+		CancelDeletion(userID int64) error
+		PurgeDeleted() (int64, error)
+		PurgeNeverActivated(createdBefore time.Time, limit int) (int64, error)
+		GetAll(search string, activated *bool, filters Filters) ([]*User, Metadata, error)
 	}
 	Tokens interface {
 		New(userID int64, ttl time.Duration, scope string) (*Token, error)
+		NewSession(userID int64, accessTTL, refreshTTL time.Duration, ip, userAgent string) (*Token, *Token, error)
+		Rotate(refreshPlaintext string, accessTTL, refreshTTL time.Duration, ip, userAgent string) (*Token, *Token, error)
 		Insert(token *Token) error
 		DeleteAllForUser(scope string, userID int64) error
+		Consume(scope string, tokenPlaintext string) (int64, error)
+		DeleteExpired(limit int) (int64, error)
+		Touch(tokenPlaintext string) error
+		GetSessionsForUser(userID int64, currentPlaintext, currentFamily string) ([]*Session, error)
+		RevokeSession(tokenPlaintext string) error
+		RevokeFamily(userID int64, family string) error
+		DeleteSession(userID int64, id int64) error
+		DeleteAllSessionsForUser(userID int64) error
+		DeleteOtherSessionsForUser(userID int64, currentPlaintext, currentFamily string) error
+	}
+	APIKeys interface {
+		Insert(key *APIKey) error
+		GetForKey(plaintext string) (*APIKey, error)
+		GetAllForUser(userID int64) ([]*APIKey, error)
+		Delete(userID, id int64) error
+		Touch(id int64) error
+		DeleteAllForUser(userID int64) error
+	}
+	TwoFactor interface {
+		Get(userID int64) (*TwoFactor, error)
+		Begin(userID int64, secret string) error
+		Enable(userID int64, recoveryCodes []string) error
+		Disable(userID int64) error
+		UseStep(userID int64, step int64) (bool, error)
+		UseRecoveryCode(userID int64, code string) (bool, error)
+	}
+	LoginFailures interface {
+		Get(userID int64) (*LoginFailures, error)
+		RecordFailure(userID int64, maxFailures int, lockout time.Duration) (*LoginFailures, error)
+		Reset(userID int64) error
+		GetForEmail(email string) (*LoginFailures, error)
+		RecordFailureForEmail(email string, maxFailures int, lockout time.Duration) (*LoginFailures, error)
+		DeleteStale(lockout time.Duration) (int64, error)
+	}
+	EmailChanges interface {
+		Set(userID int64, newEmail string) error
+		Get(userID int64) (string, error)
+		Delete(userID int64) error
+	}
+	Exports interface {
+		Insert(userID int64, archive []byte, ttl time.Duration) (*Token, error)
+		GetForToken(tokenPlaintext string) ([]byte, error)
+		DeleteExpired() (int64, error)
+	}
+	Locks interface {
+		TryAcquire(key int64) (release func(), acquired bool, err error)
+	}
+	Audit interface {
+		Insert(event *AuditEvent) error
+		GetAll(targetUserID int64, filters Filters) ([]*AuditEvent, Metadata, error)
+		GetAllForTarget(targetUserID int64) ([]*AuditEvent, error)
 	}
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Movies:      MovieModel{DB: db},
-		Permissions: PermissionModle{DB: db},
-		Users:       UserModel{DB: db},
-		Tokens:      TokenModel{DB: db},
+		Movies:             MovieModel{DB: db},
+		MovieViews:         MovieViewModel{DB: db},
+		MovieCollaborators: MovieCollaboratorModel{DB: db},
+		Awards:             AwardModel{DB: db},
+		Collections:        CollectionModel{DB: db},
+		Permissions:        PermissionModle{DB: db},
+		Roles:              RoleModel{DB: db},
+		Groups:             GroupModel{DB: db},
+		Users:              UserModel{DB: db},
+		Invitations:        InvitationModel{DB: db},
+		Tokens:             TokenModel{DB: db},
+		APIKeys:            APIKeyModel{DB: db},
+		TwoFactor:          TwoFactorModel{DB: db},
+		LoginFailures:      LoginFailureModel{DB: db},
+		EmailChanges:       EmailChangeModel{DB: db},
+		Exports:            ExportModel{DB: db},
+		Audit:              AuditModel{DB: db},
+		Locks:              LockModel{DB: db},
 	}
 }
 
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"greenlight.sparkyvxcx.co/internal/validator"
@@ -20,6 +21,13 @@ type Movie struct {
 	Runtime   Runtime   `json:"runtime,omitempty"`
 	Genres    []string  `json:"genres,omitempty"`
 	Version   int32     `json:"version"`
+	CreatedBy *int64    `json:"created_by,omitempty"`
+}
+
+// Check whether the movie was created by the given user. Movies created before ownership was recorded,
+// or whose creator has since been deleted, have no owner.
+func (m *Movie) IsOwnedBy(userID int64) bool {
+	return m.CreatedBy != nil && *m.CreatedBy == userID
 }
 
 func ValidateMovie(v *validator.Validator, movie *Movie) {
@@ -49,15 +57,15 @@ type MovieModel struct {
 // The Insert() method accepts a pointer to a movie struct, which should contain the data for the new record
 func (m MovieModel) Insert(movie *Movie) error {
 	query := `
-	INSERT INTO movies (title, year, runtime, genres)
-	VALUES ($1, $2, $3, $4)
+	INSERT INTO movies (title, year, runtime, genres, created_by)
+	VALUES ($1, $2, $3, $4, $5)
 	RETURNING id, created_at, version
 	`
 
 	// Create a args slice containing the values for the placeholder parameters rom the movie struct. Declaring
 	// this slice immediately next to our SQL query helps to make it nice and clear *what values are being uesd
 	// where* in the query.
-	args := []interface{}{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
+	args := []interface{}{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.CreatedBy}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -73,7 +81,7 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 		return nil, ErrRecordNotFound
 	}
 
-	query := `SELECT id, created_at, title, year, runtime, genres, version FROM movies WHERE id = $1`
+	query := `SELECT id, created_at, title, year, runtime, genres, version, created_by FROM movies WHERE id = $1`
 
 	var movie Movie
 
@@ -82,7 +90,7 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(&movie.ID, &movie.CreatedAt, &movie.Title, &movie.Year, &movie.Runtime, pq.Array(&movie.Genres), &movie.Version)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&movie.ID, &movie.CreatedAt, &movie.Title, &movie.Year, &movie.Runtime, pq.Array(&movie.Genres), &movie.Version, &movie.CreatedBy)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -158,20 +166,35 @@ func (m MovieModel) Delete(id int64) error {
 	return nil
 }
 
-func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+// GetAll() returns a page of movies matching the title and genres filters. If wonAward is not nil, only
+// movies which have (or haven't) won at least one award are returned.
+func (m MovieModel) GetAll(title string, genres []string, wonAward *bool, filters Filters) ([]*Movie, Metadata, error) {
 	query_format := `
-	SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version
+	SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version, created_by
 	 		FROM movies
+			%s
 	 		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
 	 		AND (genres @> $2 OR $2 = '{}')
+			AND ($3::boolean IS NULL OR EXISTS (SELECT 1 FROM awards WHERE awards.movie_id = movies.id AND awards.won) = $3)
 			ORDER BY %s %s, id ASC
-			LIMIT $3 OFFSET $4`
-	query := fmt.Sprintf(query_format, filters.sortColumn(), filters.sortDirection())
+			LIMIT $4 OFFSET $5`
+
+	// The popularity of a movie isn't a column of the movies table, it's the number of views over the
+	// last 7 days. Only join the view counts in when they are needed for sorting.
+	join, sortColumn := "", filters.sortColumn()
+	if sortColumn == "popularity" {
+		join = `LEFT JOIN (
+				SELECT movie_id, sum(views) AS views FROM movie_views WHERE day > CURRENT_DATE - 7 GROUP BY movie_id
+			) AS popularity ON popularity.movie_id = movies.id`
+		sortColumn = "COALESCE(popularity.views, 0)"
+	}
+
+	query := fmt.Sprintf(query_format, join, sortColumn, filters.sortDirection())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []interface{}{title, pq.Array(genres), filters.limit(), filters.offset()}
+	args := []interface{}{title, pq.Array(genres), wonAward, filters.limit(), filters.offset()}
 
 	// Use QueryContext() to execute the query. This returns a sql.Rows resultset containing the result.
 	rows, err := m.DB.QueryContext(ctx, query, args...)
@@ -198,6 +221,7 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 			&movie.Runtime,
 			pq.Array(&movie.Genres),
 			&movie.Version,
+			&movie.CreatedBy,
 		)
 		if err != nil {
 			return nil, Metadata{}, err
@@ -215,6 +239,106 @@ func (m MovieModel) GetAll(title string, genres []string, filters Filters) ([]*M
 	return movies, metadata, nil
 }
 
+// MovieSuggestion is a lightweight movie record returned by the title autocomplete endpoint.
+type MovieSuggestion struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	Year  int32  `json:"year"`
+}
+
+// Suggest() returns up to limit movies whose title starts with the given prefix (case-insensitive),
+// in alphabetical order. It is served by the movies_title_prefix_idx index, so unlike GetAll() it
+// never has to count or sort the full result set.
+func (m MovieModel) Suggest(prefix string, limit int) ([]*MovieSuggestion, error) {
+	query := `
+	SELECT id, title, year
+	FROM movies
+	WHERE lower(title) COLLATE "C" LIKE $1
+	ORDER BY lower(title) COLLATE "C", id
+	LIMIT $2`
+
+	// Suggestions are requested on every keystroke, so give up early rather than let slow queries
+	// pile up.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, escapeLike(strings.ToLower(prefix))+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []*MovieSuggestion{}
+
+	for rows.Next() {
+		var suggestion MovieSuggestion
+
+		err := rows.Scan(&suggestion.ID, &suggestion.Title, &suggestion.Year)
+		if err != nil {
+			return nil, err
+		}
+
+		suggestions = append(suggestions, &suggestion)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suggestions, nil
+}
+
+// Escape the LIKE wildcard characters in s, so that it matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// GetAllCreatedBy() returns every movie created by a user. It's used for personal data exports, so it isn't
+// paginated.
+func (m MovieModel) GetAllCreatedBy(userID int64) ([]*Movie, error) {
+	query := `
+	SELECT id, created_at, title, year, runtime, genres, version, created_by
+	FROM movies
+	WHERE created_by = $1
+	ORDER BY id ASC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+
+	for rows.Next() {
+		var movie Movie
+
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.CreatedBy,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		movies = append(movies, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return movies, nil
+}
+
 type MockMovieModel struct{}
 
 func (m MockMovieModel) Insert(movie *Movie) error {
@@ -233,6 +357,18 @@ func (m MockMovieModel) Delete(id int64) error {
 	return nil
 }
 
-func (m MockMovieModel) GetAll(title string, genres []string, filters Filters) ([]*Movie, Metadata, error) {
+func (m MockMovieModel) GetAll(title string, genres []string, wonAward *bool, filters Filters) ([]*Movie, Metadata, error) {
 	return nil, Metadata{}, nil
 }
+
+func (m MockMovieModel) GetStats(title string, genres []string) (*MovieStats, error) {
+	return nil, nil
+}
+
+func (m MockMovieModel) Suggest(prefix string, limit int) ([]*MovieSuggestion, error) {
+	return nil, nil
+}
+
+func (m MockMovieModel) GetAllCreatedBy(userID int64) ([]*Movie, error) {
+	return nil, nil
+}
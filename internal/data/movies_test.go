@@ -0,0 +1,113 @@
+package data
+
+import (
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"greenlight.sparkyvxcx.co/internal/assert"
+)
+
+func TestEscapeLike(t *testing.T) {
+	t.Run("Plain text is unchanged", func(t *testing.T) {
+		assert.Equal(t, escapeLike("the godfather"), "the godfather")
+	})
+
+	t.Run("Wildcards are escaped", func(t *testing.T) {
+		assert.Equal(t, escapeLike("100%_done"), `100\%\_done`)
+	})
+
+	t.Run("Backslashes are escaped", func(t *testing.T) {
+		assert.Equal(t, escapeLike(`a\b`), `a\\b`)
+	})
+}
+
+// BenchmarkSuggest checks the title suggestion query against its latency target of 20ms on a table of
+// a million movies. It needs a PostgreSQL database, given by the GREENLIGHT_BENCH_DSN environment
+// variable, in which it creates and then drops a bench_suggest schema:
+//
+//	GREENLIGHT_BENCH_DSN=$GREENLIGHT_DSN go test -run=^$ -bench=Suggest ./internal/data
+//
+// The query plan is logged, and must use the title prefix index from migration 000008.
+func BenchmarkSuggest(b *testing.B) {
+	dsn := os.Getenv("GREENLIGHT_BENCH_DSN")
+	if dsn == "" {
+		b.Skip("GREENLIGHT_BENCH_DSN is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	// Keep to a single connection, so that the search path set below applies to every query.
+	db.SetMaxOpenConns(1)
+
+	setup := []string{
+		`DROP SCHEMA IF EXISTS bench_suggest CASCADE`,
+		`CREATE SCHEMA bench_suggest`,
+		`SET search_path TO bench_suggest`,
+		`CREATE TABLE movies (id bigserial PRIMARY KEY, title text NOT NULL, year integer NOT NULL)`,
+		`INSERT INTO movies (title, year)
+		SELECT initcap(md5(i::text)), 1900 + i % 120 FROM generate_series(1, 1000000) AS i`,
+		`CREATE INDEX movies_title_prefix_idx ON movies ((lower(title) COLLATE "C"))`,
+		`ANALYZE movies`,
+	}
+
+	for _, query := range setup {
+		_, err := db.Exec(query)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.Cleanup(func() {
+		db.Exec(`DROP SCHEMA IF EXISTS bench_suggest CASCADE`)
+	})
+
+	var plan strings.Builder
+
+	rows, err := db.Query(`EXPLAIN ANALYZE
+	SELECT id, title, year FROM movies
+	WHERE lower(title) COLLATE "C" LIKE 'ab%'
+	ORDER BY lower(title) COLLATE "C", id
+	LIMIT 10`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			b.Fatal(err)
+		}
+		plan.WriteString(line + "\n")
+	}
+	rows.Close()
+
+	b.Log(plan.String())
+
+	if !strings.Contains(plan.String(), "movies_title_prefix_idx") {
+		b.Fatal("the suggestion query doesn't use movies_title_prefix_idx")
+	}
+
+	m := MovieModel{DB: db}
+	prefixes := []string{"a", "ab", "abc", "7", "7f", "7f3", "e", "e0", "e0d"}
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		_, err := m.Suggest(prefixes[n%len(prefixes)], 10)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.StopTimer()
+
+	if perQuery := b.Elapsed() / time.Duration(b.N); perQuery > 20*time.Millisecond {
+		b.Errorf("suggestions took %s per query, over the 20ms target", perQuery)
+	}
+}
@@ -3,37 +3,68 @@ package data
 import (
 	"context"
 	"database/sql"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
 )
 
+// PermissionsChannel is the Postgres notification channel on which changes to the permissions held by
+// users are announced. The payload is the ID of the user concerned, or PermissionsChangedAll.
+const (
+	PermissionsChannel    = "permissions_changed"
+	PermissionsChangedAll = "*"
+)
+
 type Permissions []string
 
-// Add helper method to check whether the Permissions slice contains s specific permission code.
+// Add helper method to check whether the Permissions slice grants a specific permission code, either
+// exactly or through a wildcard code.
 func (p Permissions) Include(code string) bool {
 	for i := range p {
-		if code == p[i] {
+		if grants(p[i], code) {
 			return true
 		}
 	}
 	return false
 }
 
+// Check whether a granted permission code covers the given code. A code ending in "*" covers every code
+// starting with the same prefix, so "movies:*" covers "movies:read", and "*" covers everything.
+func grants(granted, code string) bool {
+	if prefix, found := strings.CutSuffix(granted, "*"); found {
+		return strings.HasPrefix(code, prefix)
+	}
+
+	return granted == code
+}
+
 // Define the PermissionModle type.
 type PermissionModle struct {
 	DB *sql.DB
 }
 
 // The GetAllForUser() method returns all permissions codes for a specific user in a Permissions
-// slice.
+// slice: those granted directly, through the user's roles, and through the roles of the user's groups.
 func (m PermissionModle) GetAllForUser(userID int64) (Permissions, error) {
 	query := `
     SELECT permissions.code
     FROM permissions
-    INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
-    INNER JOIN users ON users_permissions.user_id = users.id
-    WHERE users.id = $1
+    WHERE permissions.id IN (
+      SELECT permission_id FROM users_permissions WHERE user_id = $1
+      UNION
+      SELECT roles_permissions.permission_id
+      FROM users_roles
+      INNER JOIN roles_permissions ON roles_permissions.role_id = users_roles.role_id
+      WHERE users_roles.user_id = $1
+      UNION
+      SELECT roles_permissions.permission_id
+      FROM user_groups_users
+      INNER JOIN user_groups_roles ON user_groups_roles.group_id = user_groups_users.group_id
+      INNER JOIN roles_permissions ON roles_permissions.role_id = user_groups_roles.role_id
+      WHERE user_groups_users.user_id = $1
+    )
+    ORDER BY permissions.code
   `
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -69,6 +100,21 @@ func (m PermissionModle) AddForUser(userID int64, codes ...string) error {
 	query := `
     INSERT INTO users_permissions
     SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+    ON CONFLICT DO NOTHING
+  `
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	return err
+}
+
+// Remove the provided permission codes from a specific user.
+func (m PermissionModle) RemoveForUser(userID int64, codes ...string) error {
+	query := `
+    DELETE FROM users_permissions
+    WHERE user_id = $1 AND permission_id IN (SELECT id FROM permissions WHERE code = ANY($2))
   `
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -77,3 +123,35 @@ func (m PermissionModle) AddForUser(userID int64, codes ...string) error {
 	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
 	return err
 }
+
+// The GetAll() method returns every permission code which can be granted.
+func (m PermissionModle) GetAll() (Permissions, error) {
+	query := `SELECT code FROM permissions ORDER BY code`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions Permissions
+
+	for rows.Next() {
+		var permission string
+
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, permission)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
@@ -0,0 +1,32 @@
+package data
+
+import (
+	"testing"
+
+	"greenlight.sparkyvxcx.co/internal/assert"
+)
+
+func TestPermissionsInclude(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions Permissions
+		code        string
+		want        bool
+	}{
+		{"Exact code", Permissions{"movies:read"}, "movies:read", true},
+		{"Missing code", Permissions{"movies:read"}, "movies:write", false},
+		{"Resource wildcard", Permissions{"movies:*"}, "movies:write", true},
+		{"Resource wildcard for another resource", Permissions{"movies:*"}, "users:admin", false},
+		{"Resource wildcard doesn't match a longer resource name", Permissions{"movies:*"}, "moviesx:read", false},
+		{"Global wildcard", Permissions{"*"}, "users:admin", true},
+		{"Wildcard code itself", Permissions{"movies:*"}, "movies:*", true},
+		{"Narrower code doesn't grant a wildcard", Permissions{"movies:read"}, "movies:*", false},
+		{"No permissions", nil, "movies:read", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.permissions.Include(tt.code), tt.want)
+		})
+	}
+}
@@ -0,0 +1,335 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"greenlight.sparkyvxcx.co/internal/validator"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrDuplicateGroupName = errors.New("duplicate group name")
+)
+
+// Role is a named bundle of permissions.
+type Role struct {
+	ID          int64       `json:"id"`
+	Name        string      `json:"name"`
+	Permissions Permissions `json:"permissions"`
+}
+
+// Group is a named set of users, who all hold the roles assigned to the group.
+type Group struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Roles     []string  `json:"roles"`
+	Members   []int64   `json:"members"`
+}
+
+func ValidateGroup(v *validator.Validator, group *Group) {
+	v.Check(group.Name != "", "name", "must be provided")
+	v.Check(len(group.Name) <= 100, "name", "must not be more than 100 bytes long")
+}
+
+type RoleModel struct {
+	DB *sql.DB
+}
+
+// GetAll() returns every role with the permissions it grants.
+func (m RoleModel) GetAll() ([]*Role, error) {
+	query := `
+	SELECT roles.id, roles.name, array_remove(array_agg(permissions.code ORDER BY permissions.code), NULL)
+	FROM roles
+	LEFT JOIN roles_permissions ON roles_permissions.role_id = roles.id
+	LEFT JOIN permissions ON permissions.id = roles_permissions.permission_id
+	GROUP BY roles.id
+	ORDER BY roles.id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*Role{}
+
+	for rows.Next() {
+		var role Role
+
+		err := rows.Scan(&role.ID, &role.Name, pq.Array(&role.Permissions))
+		if err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, &role)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// GetAllForUser() returns the names of the roles assigned directly to a user.
+func (m RoleModel) GetAllForUser(userID int64) ([]string, error) {
+	query := `
+	SELECT COALESCE(array_agg(roles.name ORDER BY roles.name), '{}')
+	FROM roles
+	INNER JOIN users_roles ON users_roles.role_id = roles.id
+	WHERE users_roles.user_id = $1
+	`
+
+	var names []string
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(pq.Array(&names))
+	if err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+// Assign the named roles to a user.
+func (m RoleModel) AddForUser(userID int64, names ...string) error {
+	query := `
+	INSERT INTO users_roles
+	SELECT $1, roles.id FROM roles WHERE roles.name = ANY($2)
+	ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(names))
+	return err
+}
+
+// Remove the named roles from a user.
+func (m RoleModel) RemoveForUser(userID int64, names ...string) error {
+	query := `
+	DELETE FROM users_roles
+	WHERE user_id = $1 AND role_id IN (SELECT id FROM roles WHERE name = ANY($2))
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(names))
+	return err
+}
+
+type GroupModel struct {
+	DB *sql.DB
+}
+
+func (m GroupModel) Insert(group *Group) error {
+	query := `
+	INSERT INTO user_groups (name)
+	VALUES ($1)
+	RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, group.Name).Scan(&group.ID, &group.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "user_groups_name_key"`:
+			return ErrDuplicateGroupName
+		default:
+			return err
+		}
+	}
+
+	group.Roles = []string{}
+	group.Members = []int64{}
+
+	return nil
+}
+
+// The groups are read with their roles and members aggregated into arrays.
+const groupColumns = `
+	SELECT user_groups.id, user_groups.created_at, user_groups.name,
+		COALESCE((SELECT array_agg(roles.name ORDER BY roles.name) FROM user_groups_roles
+			INNER JOIN roles ON roles.id = user_groups_roles.role_id
+			WHERE user_groups_roles.group_id = user_groups.id), '{}'),
+		COALESCE((SELECT array_agg(user_id ORDER BY user_id) FROM user_groups_users
+			WHERE user_groups_users.group_id = user_groups.id), '{}')
+	FROM user_groups`
+
+func (m GroupModel) Get(id int64) (*Group, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := groupColumns + `
+	WHERE user_groups.id = $1`
+
+	var group Group
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&group.ID,
+		&group.CreatedAt,
+		&group.Name,
+		pq.Array(&group.Roles),
+		pq.Array(&group.Members),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &group, nil
+}
+
+func (m GroupModel) GetAll() ([]*Group, error) {
+	query := groupColumns + `
+	ORDER BY user_groups.name`
+
+	return m.getAll(query)
+}
+
+// GetAllForUser() returns every group a user is a member of.
+func (m GroupModel) GetAllForUser(userID int64) ([]*Group, error) {
+	query := groupColumns + `
+	WHERE EXISTS (SELECT 1 FROM user_groups_users
+		WHERE user_groups_users.group_id = user_groups.id AND user_groups_users.user_id = $1)
+	ORDER BY user_groups.name`
+
+	return m.getAll(query, userID)
+}
+
+func (m GroupModel) getAll(query string, args ...interface{}) ([]*Group, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []*Group{}
+
+	for rows.Next() {
+		var group Group
+
+		err := rows.Scan(
+			&group.ID,
+			&group.CreatedAt,
+			&group.Name,
+			pq.Array(&group.Roles),
+			pq.Array(&group.Members),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, &group)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+func (m GroupModel) Delete(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `DELETE FROM user_groups WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Add users to a group. IDs which don't belong to any user are ignored.
+func (m GroupModel) AddMembers(groupID int64, userIDs ...int64) error {
+	query := `
+	INSERT INTO user_groups_users
+	SELECT $1, users.id FROM users WHERE users.id = ANY($2)
+	ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, groupID, pq.Array(userIDs))
+	return err
+}
+
+func (m GroupModel) RemoveMembers(groupID int64, userIDs ...int64) error {
+	query := `DELETE FROM user_groups_users WHERE group_id = $1 AND user_id = ANY($2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, groupID, pq.Array(userIDs))
+	return err
+}
+
+// Assign the named roles to a group.
+func (m GroupModel) AddRoles(groupID int64, names ...string) error {
+	query := `
+	INSERT INTO user_groups_roles
+	SELECT $1, roles.id FROM roles WHERE roles.name = ANY($2)
+	ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, groupID, pq.Array(names))
+	return err
+}
+
+func (m GroupModel) RemoveRoles(groupID int64, names ...string) error {
+	query := `
+	DELETE FROM user_groups_roles
+	WHERE group_id = $1 AND role_id IN (SELECT id FROM roles WHERE name = ANY($2))
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, groupID, pq.Array(names))
+	return err
+}
@@ -0,0 +1,128 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// MovieStats holds aggregate statistics about the movies matching a title/genres filter.
+type MovieStats struct {
+	Total   int            `json:"total"`
+	Genres  map[string]int `json:"genres"`
+	Years   []YearCount    `json:"years"`
+	Runtime RuntimeStats   `json:"runtime"`
+}
+
+// YearCount is a single bucket of the per-year histogram.
+type YearCount struct {
+	Year  int32 `json:"year"`
+	Count int   `json:"count"`
+}
+
+// RuntimeStats holds the runtime distribution, in minutes.
+type RuntimeStats struct {
+	Min int32   `json:"min"`
+	Avg float64 `json:"avg"`
+	Max int32   `json:"max"`
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+}
+
+// GetStats() computes the catalog statistics with SQL aggregates, applying the same title and genres
+// filtering as GetAll().
+func (m MovieModel) GetStats(title string, genres []string) (*MovieStats, error) {
+	where := `
+	WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
+	AND (genres @> $2 OR $2 = '{}')`
+
+	args := []interface{}{title, pq.Array(genres)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	stats := MovieStats{
+		Genres: make(map[string]int),
+		Years:  []YearCount{},
+	}
+
+	// The percentile and average aggregates return NULL over an empty set, so coalesce them to zero.
+	query := `
+	SELECT count(*),
+		COALESCE(min(runtime), 0),
+		COALESCE(avg(runtime), 0),
+		COALESCE(max(runtime), 0),
+		COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY runtime), 0),
+		COALESCE(percentile_cont(0.9) WITHIN GROUP (ORDER BY runtime), 0),
+		COALESCE(percentile_cont(0.99) WITHIN GROUP (ORDER BY runtime), 0)
+	FROM movies` + where
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&stats.Total,
+		&stats.Runtime.Min,
+		&stats.Runtime.Avg,
+		&stats.Runtime.Max,
+		&stats.Runtime.P50,
+		&stats.Runtime.P90,
+		&stats.Runtime.P99,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT genre, count(*)
+	FROM movies, unnest(genres) AS genre` + where + `
+	GROUP BY genre`
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var genre string
+		var count int
+
+		err := rows.Scan(&genre, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		stats.Genres[genre] = count
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT year, count(*)
+	FROM movies` + where + `
+	GROUP BY year
+	ORDER BY year ASC`
+
+	rows, err = m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var bucket YearCount
+
+		err := rows.Scan(&bucket.Year, &bucket.Count)
+		if err != nil {
+			return nil, err
+		}
+
+		stats.Years = append(stats.Years, bucket)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
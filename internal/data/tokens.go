@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"errors"
 	"time"
 
 	"greenlight.sparkyvxcx.co/internal/validator"
@@ -15,6 +16,16 @@ import (
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopePasswordReset  = "password-reset"
+	ScopeRefresh        = "refresh"
+	ScopeTwoFactor      = "two-factor"
+	ScopeUnlock         = "unlock"
+	ScopeEmailChange    = "email-change"
+	ScopeMagicLink      = "magic-link"
+)
+
+var (
+	ErrTokenReused = errors.New("token reused")
 )
 
 // Define Token struct to hold the data for an individual token.
@@ -24,6 +35,21 @@ type Token struct {
 	UserID    int64     `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	IP        string    `json:"-"`
+	UserAgent string    `json:"-"`
+	Family    string    `json:"-"`
+}
+
+// Session describes a login to its owner, without exposing any of its tokens. A session is a token
+// family: the tokens issued at login together with all the tokens issued by refreshing them.
+type Session struct {
+	ID         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Expiry     time.Time  `json:"expiry"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	Current    bool       `json:"current"`
 }
 
 func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -72,10 +98,161 @@ func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 	return token, err
 }
 
+// NewSession() creates a new token family for a user: an authentication (access) token and a refresh token
+// which can be exchanged for new ones. The IP address and user agent of the client are recorded on both.
+// An accessTTL of zero creates only the refresh token, for when authentication tokens are issued as signed
+// tokens which aren't stored; the returned access token is then nil.
+func (m TokenModel) NewSession(userID int64, accessTTL, refreshTTL time.Duration, ip, userAgent string) (*Token, *Token, error) {
+	family, err := generateFamily()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	access, refresh, err := insertSessionTokens(ctx, tx, userID, family, accessTTL, refreshTTL, ip, userAgent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return access, refresh, tx.Commit()
+}
+
+// Rotate() exchanges a refresh token for a new authentication token and a new refresh token in the same
+// family. The presented refresh token is marked as rotated rather than deleted. If a rotated token is ever
+// presented again, it has either been stolen or replayed, so the whole family is revoked and
+// ErrTokenReused is returned. An unknown or expired token returns ErrRecordNotFound.
+func (m TokenModel) Rotate(refreshPlaintext string, accessTTL, refreshTTL time.Duration, ip, userAgent string) (*Token, *Token, error) {
+	hash := sha256.Sum256([]byte(refreshPlaintext))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		userID    int64
+		family    string
+		expiry    time.Time
+		rotatedAt *time.Time
+	)
+
+	// Lock the row, so that two concurrent refreshes with the same token can't both succeed.
+	query := `
+	SELECT user_id, family, expiry, rotated_at
+	FROM tokens
+	WHERE hash = $1 AND scope = $2
+	FOR UPDATE
+	`
+
+	err = tx.QueryRowContext(ctx, query, hash[:], ScopeRefresh).Scan(&userID, &family, &expiry, &rotatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	if !expiry.After(time.Now()) {
+		return nil, nil, ErrRecordNotFound
+	}
+
+	if rotatedAt != nil {
+		_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE family = $1`, family)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return nil, nil, ErrTokenReused
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE tokens SET rotated_at = NOW() WHERE hash = $1`, hash[:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	access, refresh, err := insertSessionTokens(ctx, tx, userID, family, accessTTL, refreshTTL, ip, userAgent)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return access, refresh, tx.Commit()
+}
+
+func insertSessionTokens(ctx context.Context, tx *sql.Tx, userID int64, family string, accessTTL, refreshTTL time.Duration, ip, userAgent string) (*Token, *Token, error) {
+	refresh, err := generateToken(userID, refreshTTL, ScopeRefresh)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokens := []*Token{refresh}
+
+	var access *Token
+
+	if accessTTL > 0 {
+		access, err = generateToken(userID, accessTTL, ScopeAuthentication)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		tokens = append(tokens, access)
+	}
+
+	query := `
+	INSERT INTO tokens (hash, user_id, expiry, scope, ip, user_agent, family)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	for _, token := range tokens {
+		token.IP = ip
+		token.UserAgent = userAgent
+		token.Family = family
+
+		args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope, token.IP, token.UserAgent, token.Family}
+
+		_, err = tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return access, refresh, nil
+}
+
+// Generate a random identifier for a new token family.
+func generateFamily() (string, error) {
+	randomBytes := make([]byte, 16)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes), nil
+}
+
 func (m TokenModel) Insert(token *Token) error {
-	query := `INSERT INTO tokens (hash, user_id, expiry, scope) VALUES ($1, $2, $3, $4)`
+	query := `INSERT INTO tokens (hash, user_id, expiry, scope, ip, user_agent, family) VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))`
 
-	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope}
+	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope, token.IP, token.UserAgent, token.Family}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -93,3 +270,209 @@ func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	_, err := m.DB.ExecContext(ctx, query, scope, userID)
 	return err
 }
+
+// Consume() deletes a token that hasn't expired and returns the ID of its user, in a single statement so
+// that a token can only be consumed once even when it's used concurrently. ErrRecordNotFound is returned
+// if there is no such token.
+func (m TokenModel) Consume(scope string, tokenPlaintext string) (int64, error) {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+	DELETE FROM tokens
+	WHERE hash = $1 AND scope = $2 AND expiry > $3
+	RETURNING user_id
+	`
+
+	var userID int64
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, hash[:], scope, time.Now()).Scan(&userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return userID, nil
+}
+
+// RevokeSession() deletes an authentication token together with the rest of its family, so that the
+// refresh token issued alongside it can't be used either.
+func (m TokenModel) RevokeSession(tokenPlaintext string) error {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+	DELETE FROM tokens
+	WHERE hash = $1 OR family = (SELECT family FROM tokens WHERE hash = $1)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, hash[:])
+	return err
+}
+
+// RevokeFamily() deletes every token in a user's token family. It's used to log out a session which was
+// authenticated with a signed token, which can't be looked up itself.
+func (m TokenModel) RevokeFamily(userID int64, family string) error {
+	query := `DELETE FROM tokens WHERE user_id = $1 AND family = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, family)
+	return err
+}
+
+// Touch() records that a token has just been used. To avoid a write on every request, the timestamp is
+// only updated if it is more than a minute old.
+func (m TokenModel) Touch(tokenPlaintext string) error {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+	UPDATE tokens SET last_used_at = NOW()
+	WHERE hash = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, hash[:])
+	return err
+}
+
+// GetSessionsForUser() returns the active sessions of a user, most recent first. Each session is
+// represented by the live refresh token of its family; authentication tokens issued without a refresh
+// token are listed on their own. The session that currentPlaintext belongs to, or the currentFamily token
+// family for requests authenticated with a signed token, is flagged as the current one.
+func (m TokenModel) GetSessionsForUser(userID int64, currentPlaintext, currentFamily string) ([]*Session, error) {
+	hash := sha256.Sum256([]byte(currentPlaintext))
+
+	query := `
+	SELECT id, created_at,
+		CASE WHEN family IS NULL THEN last_used_at
+		ELSE (SELECT max(last_used_at) FROM tokens AS member WHERE member.family = tokens.family) END,
+		expiry, ip, user_agent,
+		COALESCE(hash = $4 OR family = (SELECT family FROM tokens WHERE hash = $4) OR family = $5, false)
+	FROM tokens
+	WHERE user_id = $1 AND expiry > NOW() AND (
+		(scope = $2 AND rotated_at IS NULL) OR (scope = $3 AND family IS NULL)
+	)
+	ORDER BY created_at DESC, id DESC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, ScopeRefresh, ScopeAuthentication, hash[:], currentFamily)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+
+	for rows.Next() {
+		var session Session
+
+		err := rows.Scan(
+			&session.ID,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.Expiry,
+			&session.IP,
+			&session.UserAgent,
+			&session.Current,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, &session)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// DeleteSession() revokes one of a user's sessions by ID, deleting every token in its family.
+func (m TokenModel) DeleteSession(userID int64, id int64) error {
+	query := `
+	DELETE FROM tokens
+	WHERE user_id = $2 AND scope IN ($3, $4)
+	AND (id = $1 OR family = (SELECT family FROM tokens WHERE id = $1 AND user_id = $2))
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID, ScopeAuthentication, ScopeRefresh)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteAllSessionsForUser() revokes every session of a user, logging them out everywhere.
+func (m TokenModel) DeleteAllSessionsForUser(userID int64) error {
+	query := `DELETE FROM tokens WHERE user_id = $1 AND scope IN ($2, $3)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, ScopeAuthentication, ScopeRefresh)
+	return err
+}
+
+// DeleteOtherSessionsForUser() revokes every session of a user except the current one, identified like in
+// GetSessionsForUser().
+func (m TokenModel) DeleteOtherSessionsForUser(userID int64, currentPlaintext, currentFamily string) error {
+	hash := sha256.Sum256([]byte(currentPlaintext))
+
+	query := `
+	DELETE FROM tokens
+	WHERE user_id = $1 AND scope IN ($2, $3) AND hash <> $4
+	AND family IS DISTINCT FROM COALESCE((SELECT family FROM tokens WHERE hash = $4), NULLIF($5, ''))
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, ScopeAuthentication, ScopeRefresh, hash[:], currentFamily)
+	return err
+}
+
+// DeleteExpired() deletes up to limit expired tokens, of any scope.
+func (m TokenModel) DeleteExpired(limit int) (int64, error) {
+	query := `
+	DELETE FROM tokens
+	WHERE hash IN (SELECT hash FROM tokens WHERE expiry < NOW() LIMIT $1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
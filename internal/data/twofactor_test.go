@@ -0,0 +1,22 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"greenlight.sparkyvxcx.co/internal/assert"
+)
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes()
+	assert.NilError(t, err)
+	assert.Equal(t, len(codes), recoveryCodeCount)
+	assert.Equal(t, len(codes[0]), 11)
+
+	t.Run("Codes should match however they are typed", func(t *testing.T) {
+		code := codes[0]
+		typed := strings.ToLower(strings.Replace(code, "-", " ", 1))
+
+		assert.Equal(t, string(hashRecoveryCode(typed)), string(hashRecoveryCode(code)))
+	})
+}
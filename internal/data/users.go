@@ -5,10 +5,13 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 	"greenlight.sparkyvxcx.co/internal/validator"
+
+	"github.com/lib/pq"
 )
 
 var (
@@ -25,6 +28,9 @@ type User struct {
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
 	Version   int       `json:"-"`
+
+	// DeletionScheduledAt is when the account will be purged, if its owner asked for it to be deleted.
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
 }
 
 // Check if a User instance is the AnonymousUser.
@@ -37,10 +43,10 @@ type password struct {
 	hash      []byte
 }
 
-// The Set() method calculates the bcrypt hash of a plaintext password, and stores both the hash
-// and the plaintext versions in the struct.
+// The Set() method calculates the argon2id hash of a plaintext password, with the current
+// PasswordHashParams, and stores both the hash and the plaintext versions in the struct.
 func (p *password) Set(plaintextPassword string) error {
-	hash, err := bcrypt.GenerateFromPassword([]byte(plaintextPassword), 12)
+	hash, err := hashArgon2id(plaintextPassword, PasswordHashParams)
 	if err != nil {
 		return err
 	}
@@ -52,8 +58,19 @@ func (p *password) Set(plaintextPassword string) error {
 }
 
 // The Matches() method check whether the provided plaintext password matches the hashed password
-// stored in the struct, returning true if it matches and false otherwise.
+// stored in the struct, returning true if it matches and false otherwise. Both argon2id hashes and
+// the bcrypt hashes created before them are supported.
 func (p *password) Matches(plaintextPassword string) (bool, error) {
+	if isArgon2idHash(p.hash) {
+		return compareArgon2id(p.hash, plaintextPassword)
+	}
+
+	// bcrypt only looks at the first 72 bytes of a password, and passwords were limited to that length
+	// when bcrypt was in use, so a longer one can't be right.
+	if len(plaintextPassword) > 72 {
+		return false, nil
+	}
+
 	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextPassword))
 	if err != nil {
 		switch {
@@ -67,6 +84,21 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 	return true, nil
 }
 
+// The NeedsRehash() method reports whether the stored hash was created with another algorithm or other
+// parameters than the current ones, and should be replaced next time the plaintext password is known.
+func (p *password) NeedsRehash() bool {
+	if !isArgon2idHash(p.hash) {
+		return true
+	}
+
+	params, _, _, err := decodeArgon2id(p.hash)
+	if err != nil {
+		return true
+	}
+
+	return params != PasswordHashParams
+}
+
 func ValidateEmail(v *validator.Validator, email string) {
 	v.Check(email != "", "email", "must be provided")
 	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
@@ -75,7 +107,7 @@ func ValidateEmail(v *validator.Validator, email string) {
 func ValidatePasswordPlaintext(v *validator.Validator, password string) {
 	v.Check(password != "", "password", "must be provided")
 	v.Check(len(password) >= 8, "password", "must be at least 8 bytes long")
-	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
+	v.Check(len(password) <= 1024, "password", "must not be more than 1024 bytes long")
 }
 
 func ValidateUser(v *validator.Validator, user *User) {
@@ -104,8 +136,8 @@ type UserModel struct {
 // Insert a new record in the database for the user.
 func (m UserModel) Insert(user *User) error {
 	query := `
-	INSERT INTO users (name, email, password_hash, activated)
-	VALUES ($1, $2, $3, $4)
+	INSERT INTO users (name, email, password_hash, activated, activated_at)
+	VALUES ($1, $2, $3, $4, CASE WHEN $4 THEN NOW() END)
 	RETURNING id, created_at, version
 	`
 
@@ -130,10 +162,49 @@ func (m UserModel) Insert(user *User) error {
 	return nil
 }
 
+// Retrieve the User details from the database based on the user's ID.
+func (m UserModel) Get(id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT id, created_at, name, email, password_hash, activated, version, deletion_scheduled_at
+	FROM users
+	WHERE id = $1
+	`
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+		&user.DeletionScheduledAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
 // Retrieve the User details from the database based on the user's email address.
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-	SELECT id, created_at, name, email, password_hash, activated, version
+	SELECT id, created_at, name, email, password_hash, activated, version, deletion_scheduled_at
 	FROM users
 	WHERE email = $1
 	`
@@ -151,6 +222,7 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Password.hash,
 		&user.Activated,
 		&user.Version,
+		&user.DeletionScheduledAt,
 	)
 
 	if err != nil {
@@ -165,12 +237,15 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
-// Update the details for a specific user.
+// Update the details for a specific user. Deactivating a user also revokes their signed authentication
+// tokens, which would otherwise keep saying the user is activated.
 func (m UserModel) Update(user *User) error {
 	// Check agaisnt the version field to help prevent any race conditions during request cycle.
 	query := `
 	UPDATE users
-	SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
+	SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1,
+		activated_at = CASE WHEN $4 AND activated_at IS NULL THEN NOW() ELSE activated_at END,
+		token_generation = CASE WHEN activated AND NOT $4 THEN token_generation + 1 ELSE token_generation END
 	WHERE id = $5 AND version = $6
 	RETURNING version
 	`
@@ -207,7 +282,7 @@ func (m UserModel) GetForToken(tokenScope string, tokenPlaintext string) (*User,
 	sha256Hash := sha256.Sum256([]byte(tokenPlaintext))
 
 	query := `
-	SELECT id, created_at, name, email, password_hash, activated, version
+	SELECT id, created_at, name, email, password_hash, activated, version, deletion_scheduled_at
 	FROM users
 	WHERE id = (SELECT user_id FROM tokens WHERE hash = $1 AND scope = $2 AND expiry > $3)
 	`
@@ -234,6 +309,7 @@ func (m UserModel) GetForToken(tokenScope string, tokenPlaintext string) (*User,
 		&user.Password.hash,
 		&user.Activated,
 		&user.Version,
+		&user.DeletionScheduledAt,
 	)
 
 	if err != nil {
@@ -247,3 +323,185 @@ func (m UserModel) GetForToken(tokenScope string, tokenPlaintext string) (*User,
 
 	return &user, nil
 }
+
+// ScheduleDeletion() marks a user's account to be purged at the given time, and revokes the user's signed
+// authentication tokens.
+func (m UserModel) ScheduleDeletion(userID int64, at time.Time) error {
+	query := `
+	UPDATE users
+	SET deletion_scheduled_at = $2, token_generation = token_generation + 1, version = version + 1
+	WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, at)
+	return err
+}
+
+// GetTokenGeneration() returns the token generation of a user. Signed authentication tokens issued for an
+// earlier generation have been revoked.
+func (m UserModel) GetTokenGeneration(userID int64) (int32, error) {
+	query := `SELECT token_generation FROM users WHERE id = $1`
+
+	var generation int32
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&generation)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return generation, nil
+}
+
+// RevokeSignedTokens() revokes every signed authentication token issued so far to the given users, by
+// bumping their token generation. Signed tokens can't be deleted, since they aren't stored.
+func (m UserModel) RevokeSignedTokens(userIDs ...int64) error {
+	query := `UPDATE users SET token_generation = token_generation + 1 WHERE id = ANY($1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, pq.Array(userIDs))
+	return err
+}
+
+// RevokeSignedTokensForGroup() revokes the signed authentication tokens of every member of a group.
+func (m UserModel) RevokeSignedTokensForGroup(groupID int64) error {
+	query := `
+	UPDATE users SET token_generation = token_generation + 1
+	WHERE id IN (SELECT user_id FROM user_groups_users WHERE group_id = $1)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, groupID)
+	return err
+}
+
+// CancelDeletion() removes a user's scheduled deletion. It returns ErrRecordNotFound if none was scheduled.
+func (m UserModel) CancelDeletion(userID int64) error {
+	query := `
+	UPDATE users SET deletion_scheduled_at = NULL, version = version + 1
+	WHERE id = $1 AND deletion_scheduled_at IS NOT NULL
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// PurgeDeleted() deletes the accounts whose scheduled deletion time has passed, and returns how many were
+// deleted. Everything belonging to them (tokens, permissions, API keys, personal collections, exports) is
+// removed with them through ON DELETE CASCADE.
+func (m UserModel) PurgeDeleted() (int64, error) {
+	query := `DELETE FROM users WHERE deletion_scheduled_at <= NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// PurgeNeverActivated() deletes up to limit accounts which were created before the given time and never
+// activated. Accounts deactivated by an administrator aren't concerned.
+func (m UserModel) PurgeNeverActivated(createdBefore time.Time, limit int) (int64, error) {
+	query := `
+	DELETE FROM users
+	WHERE id IN (
+		SELECT id FROM users
+		WHERE activated_at IS NULL AND NOT activated AND created_at < $1
+		LIMIT $2
+	)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, createdBefore, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// GetAll() returns a page of users for administrators. The search string matches a part of the name or
+// email address, and activated, if not nil, filters on the activation state.
+func (m UserModel) GetAll(search string, activated *bool, filters Filters) ([]*User, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, created_at, name, email, password_hash, activated, version, deletion_scheduled_at
+	FROM users
+	WHERE (name ILIKE '%%' || $1 || '%%' OR email ILIKE '%%' || $1 || '%%' OR $1 = '')
+	AND (activated = $2 OR $2 IS NULL)
+	ORDER BY %s %s, id ASC
+	LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, escapeLike(search), activated, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	users := []*User{}
+
+	for rows.Next() {
+		var user User
+
+		err := rows.Scan(
+			&totalRecords,
+			&user.ID,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.Password.hash,
+			&user.Activated,
+			&user.Version,
+			&user.DeletionScheduledAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		users = append(users, &user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return users, metadata, nil
+}
@@ -1,8 +1,10 @@
 package data
 
 import (
+	"strings"
 	"testing"
 
+	"golang.org/x/crypto/bcrypt"
 	"greenlight.sparkyvxcx.co/internal/assert"
 	"greenlight.sparkyvxcx.co/internal/validator"
 )
@@ -27,3 +29,82 @@ func TestValidateEmail(t *testing.T) {
 		assert.Equal(t, v.Errors["email"], "must be a valid email address")
 	})
 }
+
+func TestPassword(t *testing.T) {
+	// Keep the hashing cheap, the parameters don't matter to the tests.
+	defaultParams := PasswordHashParams
+	PasswordHashParams = Argon2idParams{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	t.Cleanup(func() { PasswordHashParams = defaultParams })
+
+	t.Run("Argon2id Hash Should Match", func(t *testing.T) {
+		var p password
+
+		err := p.Set("pa55word-long-enough")
+		assert.NilError(t, err)
+		assert.Equal(t, strings.HasPrefix(string(p.hash), "$argon2id$v=19$m=64,t=1,p=1$"), true)
+
+		match, err := p.Matches("pa55word-long-enough")
+		assert.NilError(t, err)
+		assert.Equal(t, match, true)
+
+		match, err = p.Matches("wrong-password")
+		assert.NilError(t, err)
+		assert.Equal(t, match, false)
+
+		assert.Equal(t, p.NeedsRehash(), false)
+	})
+
+	t.Run("Changed Parameters Need Rehash", func(t *testing.T) {
+		var p password
+
+		err := p.Set("pa55word-long-enough")
+		assert.NilError(t, err)
+
+		PasswordHashParams.Iterations = 2
+		defer func() { PasswordHashParams.Iterations = 1 }()
+
+		assert.Equal(t, p.NeedsRehash(), true)
+
+		// The hash keeps verifying with the parameters recorded in it.
+		match, err := p.Matches("pa55word-long-enough")
+		assert.NilError(t, err)
+		assert.Equal(t, match, true)
+	})
+
+	t.Run("Bcrypt Hash Should Match And Need Rehash", func(t *testing.T) {
+		hash, err := bcrypt.GenerateFromPassword([]byte("pa55word"), bcrypt.MinCost)
+		assert.NilError(t, err)
+
+		p := password{hash: hash}
+
+		match, err := p.Matches("pa55word")
+		assert.NilError(t, err)
+		assert.Equal(t, match, true)
+
+		// bcrypt would only compare the first 72 bytes.
+		match, err = p.Matches("pa55word" + strings.Repeat("x", 72))
+		assert.NilError(t, err)
+		assert.Equal(t, match, false)
+
+		assert.Equal(t, p.NeedsRehash(), true)
+	})
+}
+
+func TestValidatePasswordPlaintext(t *testing.T) {
+	t.Run("Passwords Longer Than 72 Bytes Should Pass", func(t *testing.T) {
+		v := validator.New()
+
+		ValidatePasswordPlaintext(v, strings.Repeat("x", 100))
+
+		assert.Equal(t, v.Valid(), true)
+	})
+
+	t.Run("Short Password Should Fail", func(t *testing.T) {
+		v := validator.New()
+
+		ValidatePasswordPlaintext(v, "short")
+
+		assert.Equal(t, v.Valid(), false)
+		assert.Equal(t, v.Errors["password"], "must be at least 8 bytes long")
+	})
+}
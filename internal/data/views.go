@@ -0,0 +1,94 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// TrendingMovie is a movie together with the number of times it was viewed within the trending window.
+type TrendingMovie struct {
+	Movie
+	Views int64 `json:"views"`
+}
+
+type MovieViewModel struct {
+	DB *sql.DB
+}
+
+// Record() adds a batch of view counts, keyed by movie ID, to today's totals. Counts for movies which
+// have been deleted in the meantime are dropped.
+func (m MovieViewModel) Record(counts map[int64]int64) error {
+	movieIDs := make([]int64, 0, len(counts))
+	views := make([]int64, 0, len(counts))
+
+	for movieID, count := range counts {
+		movieIDs = append(movieIDs, movieID)
+		views = append(views, count)
+	}
+
+	query := `
+	INSERT INTO movie_views (movie_id, day, views)
+	SELECT batch.movie_id, CURRENT_DATE, batch.views
+	FROM unnest($1::bigint[], $2::bigint[]) AS batch(movie_id, views)
+	INNER JOIN movies ON movies.id = batch.movie_id
+	ON CONFLICT (movie_id, day) DO UPDATE SET views = movie_views.views + EXCLUDED.views
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, pq.Array(movieIDs), pq.Array(views))
+	return err
+}
+
+// GetTrending() returns the most viewed movies over the last given number of days. Views are counted
+// in daily buckets, so the window is made of today's partial bucket and the days-1 days before it.
+func (m MovieViewModel) GetTrending(days int, limit int) ([]*TrendingMovie, error) {
+	query := `
+	SELECT movies.id, movies.created_at, movies.title, movies.year, movies.runtime, movies.genres, movies.version, sum(movie_views.views) AS views
+	FROM movie_views
+	INNER JOIN movies ON movies.id = movie_views.movie_id
+	WHERE movie_views.day > CURRENT_DATE - $1::integer
+	GROUP BY movies.id
+	ORDER BY views DESC, movies.id ASC
+	LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, days, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := []*TrendingMovie{}
+
+	for rows.Next() {
+		var movie TrendingMovie
+
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.Version,
+			&movie.Views,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		movies = append(movies, &movie)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return movies, nil
+}
@@ -0,0 +1,91 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// BreachedList is a set of breached passwords, identified by their SHA-1 hashes.
+type BreachedList struct {
+	hashes [][sha1.Size]byte
+}
+
+// LoadBreachedList reads a breached password list from a file. See ReadBreachedList() for the format.
+func LoadBreachedList(path string) (*BreachedList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadBreachedList(f)
+}
+
+// ReadBreachedList reads a breached password list holding one hex encoded SHA-1 hash per line. Anything
+// after a colon is ignored, so that the files published by Have I Been Pwned, whose lines look like
+// "<hash>:<count>", can be used as they are. Blank lines and lines starting with "#" are skipped.
+func ReadBreachedList(r io.Reader) (*BreachedList, error) {
+	list := &BreachedList{}
+
+	scanner := bufio.NewScanner(r)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		text, _, _ = strings.Cut(text, ":")
+
+		// Check the length first, hex.Decode() doesn't check that the hash fits in its destination.
+		if len(text) != hex.EncodedLen(sha1.Size) {
+			return nil, fmt.Errorf("breached password list: line %d is not a SHA-1 hash", line)
+		}
+
+		var hash [sha1.Size]byte
+
+		_, err := hex.Decode(hash[:], []byte(text))
+		if err != nil {
+			return nil, fmt.Errorf("breached password list: line %d is not a SHA-1 hash", line)
+		}
+
+		list.hashes = append(list.hashes, hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// The published lists are sorted already, in which case this is cheap.
+	if !sort.SliceIsSorted(list.hashes, list.less) {
+		sort.Slice(list.hashes, list.less)
+	}
+
+	return list, nil
+}
+
+// Len returns the number of hashes in the list.
+func (l *BreachedList) Len() int {
+	return len(l.hashes)
+}
+
+// Contains reports whether the password is in the list.
+func (l *BreachedList) Contains(password string) bool {
+	hash := sha1.Sum([]byte(password))
+
+	i := sort.Search(len(l.hashes), func(i int) bool {
+		return bytes.Compare(l.hashes[i][:], hash[:]) >= 0
+	})
+
+	return i < len(l.hashes) && l.hashes[i] == hash
+}
+
+func (l *BreachedList) less(i, j int) bool {
+	return bytes.Compare(l.hashes[i][:], l.hashes[j][:]) < 0
+}
@@ -0,0 +1,53 @@
+// Package passwordpolicy decides whether a password is good enough to be set on an account, on top of
+// the length limits checked by data.ValidatePasswordPlaintext(). Passwords are rejected when they are
+// easy to guess, contain the user's name or email address, or are known to have been breached.
+package passwordpolicy
+
+import (
+	"strings"
+
+	"greenlight.sparkyvxcx.co/internal/validator"
+)
+
+// Policy holds the rules passwords must follow.
+type Policy struct {
+	// MinScore is the lowest strength score (see Score()) a password may have, from 0 to 4.
+	MinScore int
+
+	// Breached lists passwords which must not be used because they appeared in a data breach. It's nil
+	// when no list is configured.
+	Breached *BreachedList
+}
+
+// Validate checks password against the policy, adding any problem to v under the "password" key. The
+// name and email of the user the password is for are needed to reject passwords containing them.
+func (p *Policy) Validate(v *validator.Validator, password, name, email string) {
+	v.Check(!containsPersonalInfo(password, name, email), "password", "must not contain your name or email address")
+	v.Check(Score(password) >= p.MinScore, "password", "is too easy to guess, try a longer password or an uncommon phrase")
+
+	if p.Breached != nil {
+		v.Check(!p.Breached.Contains(password), "password", "has appeared in a data breach and must not be used")
+	}
+}
+
+// Check whether the password contains the user's email address, the local part of it, or any part of
+// their name. Parts shorter than 3 characters are too likely to appear by chance to be rejected.
+func containsPersonalInfo(password, name, email string) bool {
+	password = strings.ToLower(password)
+
+	parts := strings.Fields(strings.ToLower(name))
+
+	email = strings.ToLower(email)
+	if local, _, found := strings.Cut(email, "@"); found {
+		parts = append(parts, local)
+	}
+	parts = append(parts, email)
+
+	for _, part := range parts {
+		if len(part) >= 3 && strings.Contains(password, part) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,94 @@
+package passwordpolicy
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"greenlight.sparkyvxcx.co/internal/assert"
+	"greenlight.sparkyvxcx.co/internal/validator"
+)
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		password string
+		want     int
+	}{
+		{"aaaaaaaaaaaa", 0},
+		{"abcdefghijkl", 0},
+		{"qwertyuiop", 0},
+		{"Password123!", 0},
+		{"k7fq2mzw", 3},
+		{"correct horse battery staple", 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			assert.Equal(t, Score(tt.password), tt.want)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	// The hashes are out of order, to check that the list gets sorted.
+	list, err := ReadBreachedList(strings.NewReader(`# test list
+FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF:1
+4C3C2A6F8F4A1F2C0C44F2C0E6D3C2E0A2B1A6E7:2
+` + sha1Hex("k7fq2mzw-breached") + `:3
+`))
+	assert.NilError(t, err)
+	assert.Equal(t, list.Len(), 3)
+
+	policy := &Policy{MinScore: 2, Breached: list}
+
+	tests := []struct {
+		name     string
+		password string
+		want     string
+	}{
+		{"Strong", "k7fq2mzw-tulip", ""},
+		{"Weak", "abcdefgh", "is too easy to guess, try a longer password or an uncommon phrase"},
+		{"Contains name", "alice-k7fq2mzw", "must not contain your name or email address"},
+		{"Contains email", "k7fq2mzwALICE.SMITH", "must not contain your name or email address"},
+		{"Breached", "k7fq2mzw-breached", "has appeared in a data breach and must not be used"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+
+			policy.Validate(v, tt.password, "Alice Jones", "alice.smith@example.com")
+
+			assert.Equal(t, v.Errors["password"], tt.want)
+		})
+	}
+}
+
+func sha1Hex(s string) string {
+	hash := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(hash[:]))
+}
+
+func TestReadBreachedListInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		list string
+	}{
+		{"Not hex", "ZZZZZZZZZZZZZZZZZZZZZZZZZZZZZZZZZZZZZZZZ:1\n"},
+		{"Too short", "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF:1\n"},
+		{"SHA-256", "# test list\n" + strings.Repeat("F", 64) + ":1\n"},
+		{"NTLM", strings.Repeat("F", 32) + ":1\n"},
+		{"Long line", strings.Repeat("F", 80) + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadBreachedList(strings.NewReader(tt.list))
+			if err == nil {
+				t.Fatal("got: nil; want: an error")
+			}
+			assert.Contains(t, err.Error(), "is not a SHA-1 hash")
+		})
+	}
+}
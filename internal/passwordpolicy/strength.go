@@ -0,0 +1,136 @@
+package passwordpolicy
+
+import (
+	"math"
+	"strings"
+)
+
+// Keyboard rows, in which runs of adjacent keys such as "qwerty" or "asdf" are as easy to guess as
+// alphabetical sequences.
+var keyboardRows = []string{
+	"`1234567890-=",
+	"qwertyuiop[]\\",
+	"asdfghjkl;'",
+	"zxcvbnm,./",
+}
+
+// A few of the most common passwords and password bases, which are among the first guesses of any
+// attacker. The breached password list, when configured, covers many more.
+var commonPasswords = map[string]bool{
+	"password": true, "passw0rd": true, "p@ssword": true, "p@ssw0rd": true, "letmein": true,
+	"welcome": true, "iloveyou": true, "admin": true, "administrator": true, "monkey": true,
+	"dragon": true, "football": true, "baseball": true, "sunshine": true, "princess": true,
+	"master": true, "shadow": true, "superman": true, "trustno1": true, "whatever": true,
+	"starwars": true, "computer": true, "michael": true, "charlie": true, "secret": true,
+	"greenlight": true, "changeme": true, "default": true, "login": true, "access": true,
+}
+
+// Score estimates how hard a password is to guess, on the same 0 to 4 scale as zxcvbn:
+//
+//	0: fewer than 10^3 guesses
+//	1: fewer than 10^6 guesses
+//	2: fewer than 10^8 guesses
+//	3: fewer than 10^10 guesses
+//	4: at least 10^10 guesses
+//
+// The estimate is simpler than zxcvbn's, but follows the same model. Common passwords, possibly with
+// digits or symbols around them, score 0. Runs of a repeated character, and alphabetical, numerical or
+// keyboard sequences of 3 characters or more, cost about as much as guessing their first character,
+// direction and length. Every other character multiplies the guesses by 10.
+func Score(password string) int {
+	guesses := log10Guesses(password)
+
+	switch {
+	case guesses < 3:
+		return 0
+	case guesses < 6:
+		return 1
+	case guesses < 8:
+		return 2
+	case guesses < 10:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// Estimate the number of guesses needed to find a password, as a power of 10.
+func log10Guesses(password string) float64 {
+	lower := strings.ToLower(password)
+
+	base := strings.TrimFunc(lower, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z')
+	})
+	if commonPasswords[lower] || commonPasswords[base] {
+		return 0
+	}
+
+	runes := []rune(lower)
+
+	var guesses float64
+
+	for i := 0; i < len(runes); {
+		n := patternLength(runes[i:])
+
+		if n >= 3 {
+			guesses += math.Log10(26 * 2 * float64(n))
+		} else {
+			n = 1
+			guesses += 1
+		}
+
+		i += n
+	}
+
+	return guesses
+}
+
+// Return the length of the longest repeat or sequence which starts the given runes, or 1 if there's none.
+func patternLength(runes []rune) int {
+	if len(runes) == 0 {
+		return 0
+	}
+
+	longest := 1
+
+	for _, kind := range []int{repeat, sequence, -sequence, keyboard, -keyboard} {
+		n := 1
+		for n < len(runes) && follows(runes[n-1], runes[n], kind) {
+			n++
+		}
+
+		if n > longest {
+			longest = n
+		}
+	}
+
+	return longest
+}
+
+// The kinds of patterns. Negative sequences run backwards.
+const (
+	repeat = iota + 1
+	sequence
+	keyboard
+)
+
+// Check whether b follows a in a pattern of the given kind.
+func follows(a, b rune, kind int) bool {
+	switch kind {
+	case repeat:
+		return a == b
+	case sequence:
+		return b == a+1
+	case -sequence:
+		return b == a-1
+	}
+
+	for _, row := range keyboardRows {
+		i, j := strings.IndexRune(row, a), strings.IndexRune(row, b)
+		if i >= 0 && j >= 0 && j-i == kind/keyboard {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,51 @@
+// Package policy holds the access rules which depend on the record being accessed, rather than only on
+// the permissions of the user. Handlers gather the facts a rule needs and ask the policy for a decision,
+// so that each rule is written down once.
+package policy
+
+import (
+	"greenlight.sparkyvxcx.co/internal/data"
+)
+
+// Actor is the user making a request, along with what they are allowed to do.
+type Actor struct {
+	ID          int64
+	Permissions data.Permissions
+
+	// Scopes restricts the permissions of a request made with an API key. It's nil for other requests.
+	Scopes data.Permissions
+}
+
+// Has reports whether the actor holds the given permission code.
+func (a Actor) Has(code string) bool {
+	if a.Scopes != nil && !a.Scopes.Include(code) {
+		return false
+	}
+
+	return a.Permissions.Include(code)
+}
+
+// CanEditMovie reports whether the actor may update a movie. Holders of movies:write can edit the movies
+// they own and those they were added to as a collaborator, and movies:moderate holders can edit every
+// movie.
+func CanEditMovie(a Actor, movie *data.Movie, collaborator bool) bool {
+	switch {
+	case a.Has("movies:moderate"):
+		return true
+	case movie.IsOwnedBy(a.ID) || collaborator:
+		return a.Has("movies:write")
+	default:
+		return false
+	}
+}
+
+// CanDeleteMovie reports whether the actor may delete a movie. Unlike editing, this isn't extended to
+// collaborators.
+func CanDeleteMovie(a Actor, movie *data.Movie) bool {
+	return a.Has("movies:moderate") || (movie.IsOwnedBy(a.ID) && a.Has("movies:write"))
+}
+
+// CanManageMovieCollaborators reports whether the actor may add or remove the collaborators of a movie.
+func CanManageMovieCollaborators(a Actor, movie *data.Movie) bool {
+	return CanDeleteMovie(a, movie)
+}
@@ -0,0 +1,50 @@
+package policy
+
+import (
+	"testing"
+
+	"greenlight.sparkyvxcx.co/internal/assert"
+	"greenlight.sparkyvxcx.co/internal/data"
+)
+
+func TestCanEditMovie(t *testing.T) {
+	owner := int64(1)
+	movie := &data.Movie{ID: 1, CreatedBy: &owner}
+
+	tests := []struct {
+		name         string
+		actor        Actor
+		collaborator bool
+		want         bool
+	}{
+		{"Owner", Actor{ID: 1, Permissions: data.Permissions{"movies:read", "movies:write"}}, false, true},
+		{"Owner without movies:write", Actor{ID: 1, Permissions: data.Permissions{"movies:read"}}, false, false},
+		{"Other writer", Actor{ID: 2, Permissions: data.Permissions{"movies:read", "movies:write"}}, false, false},
+		{"Collaborator", Actor{ID: 2, Permissions: data.Permissions{"movies:read", "movies:write"}}, true, true},
+		{"Collaborator without movies:write", Actor{ID: 2, Permissions: data.Permissions{"movies:read"}}, true, false},
+		{"Collaborator API key without scope", Actor{ID: 2, Permissions: data.Permissions{"movies:read", "movies:write"}, Scopes: data.Permissions{"movies:read"}}, true, false},
+		{"Moderator", Actor{ID: 2, Permissions: data.Permissions{"movies:*"}}, false, true},
+		{"Moderator API key without scope", Actor{ID: 2, Permissions: data.Permissions{"movies:*"}, Scopes: data.Permissions{"movies:read"}}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, CanEditMovie(tt.actor, movie, tt.collaborator), tt.want)
+		})
+	}
+
+	// Movies without an owner can only be edited by moderators.
+	writer := Actor{ID: 1, Permissions: data.Permissions{"movies:read", "movies:write"}}
+	assert.Equal(t, CanEditMovie(writer, &data.Movie{}, false), false)
+	assert.Equal(t, CanEditMovie(Actor{Permissions: data.Permissions{"movies:moderate"}}, &data.Movie{}, false), true)
+}
+
+func TestCanDeleteMovie(t *testing.T) {
+	writer := Actor{ID: 1, Permissions: data.Permissions{"movies:read", "movies:write"}}
+
+	assert.Equal(t, CanDeleteMovie(writer, &data.Movie{CreatedBy: &writer.ID}), true)
+
+	// Movies without an owner can only be deleted by moderators.
+	assert.Equal(t, CanDeleteMovie(writer, &data.Movie{}), false)
+	assert.Equal(t, CanDeleteMovie(Actor{Permissions: data.Permissions{"*"}}, &data.Movie{}), true)
+}
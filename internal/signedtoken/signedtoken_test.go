@@ -0,0 +1,89 @@
+package signedtoken
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"greenlight.sparkyvxcx.co/internal/assert"
+)
+
+func newTestKeyring(t *testing.T, current string) *Keyring {
+	t.Helper()
+
+	keys := map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, MinKeyLength),
+		"k2": bytes.Repeat([]byte{2}, MinKeyLength),
+	}
+
+	keyring, err := NewKeyring(keys, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return keyring
+}
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Now()
+	claims := Claims{UserID: 42, Activated: true, Permissions: []string{"movies:read"}, Expiry: now.Add(time.Minute).Unix()}
+
+	t.Run("Valid token should verify", func(t *testing.T) {
+		keyring := newTestKeyring(t, "k1")
+
+		token, err := keyring.Sign(claims)
+		assert.NilError(t, err)
+		assert.Equal(t, IsSigned(token), true)
+
+		verified, err := keyring.Verify(token, now)
+		assert.NilError(t, err)
+		assert.Equal(t, verified.UserID, int64(42))
+		assert.Equal(t, verified.Permissions[0], "movies:read")
+	})
+
+	t.Run("Token signed with an older key should verify after rotation", func(t *testing.T) {
+		token, err := newTestKeyring(t, "k1").Sign(claims)
+		assert.NilError(t, err)
+
+		_, err = newTestKeyring(t, "k2").Verify(token, now)
+		assert.NilError(t, err)
+	})
+
+	t.Run("Expired token should fail", func(t *testing.T) {
+		keyring := newTestKeyring(t, "k1")
+
+		token, err := keyring.Sign(claims)
+		assert.NilError(t, err)
+
+		_, err = keyring.Verify(token, now.Add(2*time.Minute))
+		assert.Equal(t, err, ErrExpiredToken)
+	})
+
+	t.Run("Tampered token should fail", func(t *testing.T) {
+		keyring := newTestKeyring(t, "k1")
+
+		token, err := keyring.Sign(claims)
+		assert.NilError(t, err)
+
+		forged, err := keyring.Sign(Claims{UserID: 1, Expiry: claims.Expiry})
+		assert.NilError(t, err)
+
+		// Swap in the payload of another token, keeping the original signature.
+		parts, forgedParts := strings.Split(token, "."), strings.Split(forged, ".")
+		parts[2] = forgedParts[2]
+
+		_, err = keyring.Verify(strings.Join(parts, "."), now)
+		assert.Equal(t, err, ErrInvalidToken)
+	})
+}
+
+func TestParseKeys(t *testing.T) {
+	keys, err := ParseKeys("k1:AQID k2:BAUG")
+	assert.NilError(t, err)
+	assert.Equal(t, len(keys), 2)
+	assert.Equal(t, keys["k2"][2], byte(6))
+
+	_, err = ParseKeys("k1")
+	assert.Equal(t, err != nil, true)
+}
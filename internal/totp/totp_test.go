@@ -0,0 +1,67 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"greenlight.sparkyvxcx.co/internal/assert"
+)
+
+// The SHA-1 test vectors from appendix B of RFC 6238, truncated to 6 digits.
+func TestCode(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := Code(secret, Step(time.Unix(tt.unix, 0)))
+		assert.NilError(t, err)
+		assert.Equal(t, code, tt.code)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	assert.NilError(t, err)
+
+	now := time.Now()
+
+	code, err := Code(secret, Step(now))
+	assert.NilError(t, err)
+
+	t.Run("Current code should pass", func(t *testing.T) {
+		step, ok := Validate(secret, code, now)
+		assert.Equal(t, ok, true)
+		assert.Equal(t, step, Step(now))
+	})
+
+	t.Run("Code from the previous period should pass", func(t *testing.T) {
+		_, ok := Validate(secret, code, now.Add(period*time.Second))
+		assert.Equal(t, ok, true)
+	})
+
+	t.Run("Stale code should fail", func(t *testing.T) {
+		_, ok := Validate(secret, code, now.Add(3*period*time.Second))
+		assert.Equal(t, ok, false)
+	})
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Greenlight", "alice@example.com", "JBSWY3DPEHPK3PXP")
+
+	assert.Equal(t, strings.HasPrefix(uri, "otpauth://totp/Greenlight:alice@example.com?"), true)
+	assert.Contains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+	assert.Contains(t, uri, "issuer=Greenlight")
+}
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS collections (
+  id bigserial PRIMARY KEY,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  name text NOT NULL,
+  description text NOT NULL DEFAULT '',
+  -- A NULL owner marks a curated collection maintained by users with movies:write.
+  owner_id bigint REFERENCES users ON DELETE CASCADE,
+  public bool NOT NULL DEFAULT true,
+  version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS collections_owner_id_idx ON collections (owner_id);
+
+CREATE TABLE IF NOT EXISTS collections_movies (
+  collection_id bigint NOT NULL REFERENCES collections ON DELETE CASCADE,
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  position integer NOT NULL CHECK (position > 0),
+  PRIMARY KEY (collection_id, movie_id),
+  -- Deferred so that positions can be shifted or reordered within a single transaction.
+  CONSTRAINT collections_movies_position_key UNIQUE (collection_id, position) DEFERRABLE INITIALLY DEFERRED
+);
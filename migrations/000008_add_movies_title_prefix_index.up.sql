@@ -0,0 +1,3 @@
+-- Byte-wise ("C" collation) ordering lets the planner answer both the prefix LIKE match and the
+-- ORDER BY of the title suggestion query from this index alone.
+CREATE INDEX IF NOT EXISTS movies_title_prefix_idx ON movies ((lower(title) COLLATE "C"));
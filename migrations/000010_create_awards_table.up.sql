@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS awards (
+  id bigserial PRIMARY KEY,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  ceremony text NOT NULL,
+  year integer NOT NULL,
+  category text NOT NULL,
+  -- The person (or film, for categories such as Best Picture) that was nominated.
+  nominee text NOT NULL,
+  movie_id bigint REFERENCES movies ON DELETE SET NULL,
+  won bool NOT NULL DEFAULT false,
+  version integer NOT NULL DEFAULT 1,
+  CONSTRAINT awards_nomination_key UNIQUE (ceremony, year, category, nominee)
+);
+
+CREATE INDEX IF NOT EXISTS awards_movie_id_idx ON awards (movie_id);
@@ -0,0 +1,6 @@
+-- Tokens issued together at login (an access token and a refresh token), and all the tokens issued by
+-- rotating that refresh token, share a family, so that they can be revoked together.
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS family text;
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS rotated_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS tokens_family_idx ON tokens (family);
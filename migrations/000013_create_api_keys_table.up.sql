@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+  id bigserial PRIMARY KEY,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  name text NOT NULL,
+  hint text NOT NULL,
+  hash bytea NOT NULL UNIQUE,
+  expiry timestamp(0) with time zone,
+  last_used_at timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
+
+-- The scopes of a key: the permissions it grants, out of those its owner holds.
+CREATE TABLE IF NOT EXISTS api_keys_permissions (
+  api_key_id bigint NOT NULL REFERENCES api_keys ON DELETE CASCADE,
+  permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+  PRIMARY KEY (api_key_id, permission_id)
+);
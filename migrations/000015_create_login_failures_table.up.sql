@@ -0,0 +1,11 @@
+-- Failed login attempts are counted per account. Once too many have been made, the account is locked until
+-- locked_until, or until it is unlocked by email or by an administrator.
+CREATE TABLE IF NOT EXISTS login_failures (
+  user_id bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+  failures integer NOT NULL DEFAULT 0,
+  last_failure_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  locked_until timestamp(0) with time zone
+);
+
+-- Administrators hold users:admin, which lets them manage other users' accounts.
+INSERT INTO permissions (code) VALUES ('users:admin');
@@ -0,0 +1,7 @@
+-- A user can have one pending email change at a time. The new address is only copied into users.email
+-- once it has been confirmed with the token sent to it.
+CREATE TABLE IF NOT EXISTS email_changes (
+  user_id bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  new_email citext NOT NULL
+);
@@ -0,0 +1,14 @@
+-- Accounts scheduled for deletion are purged once deletion_scheduled_at has passed. Until then the
+-- owner can cancel the deletion by logging in again.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_scheduled_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS users_deletion_scheduled_at_idx ON users (deletion_scheduled_at) WHERE deletion_scheduled_at IS NOT NULL;
+
+-- Personal data exports, downloadable with the token emailed to the user until they expire.
+CREATE TABLE IF NOT EXISTS data_exports (
+  hash bytea PRIMARY KEY,
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  expiry timestamp(0) with time zone NOT NULL,
+  archive jsonb NOT NULL
+);
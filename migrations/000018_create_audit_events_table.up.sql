@@ -0,0 +1,13 @@
+-- The audit trail of administrative actions. Events outlive the users they mention, so the references are
+-- set to NULL rather than cascading when a user is deleted.
+CREATE TABLE IF NOT EXISTS audit_events (
+  id bigserial PRIMARY KEY,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  actor_id bigint REFERENCES users ON DELETE SET NULL,
+  target_user_id bigint REFERENCES users ON DELETE SET NULL,
+  action text NOT NULL,
+  details jsonb NOT NULL DEFAULT '{}',
+  ip text NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_target_user_id_idx ON audit_events (target_user_id);
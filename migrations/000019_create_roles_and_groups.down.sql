@@ -0,0 +1,25 @@
+-- Expand roles, including those held through groups, back into direct grants.
+INSERT INTO users_permissions
+SELECT DISTINCT holders.user_id, permissions.id
+FROM (
+  SELECT user_id, role_id FROM users_roles
+  UNION
+  SELECT user_groups_users.user_id, user_groups_roles.role_id
+  FROM user_groups_users
+  INNER JOIN user_groups_roles ON user_groups_roles.group_id = user_groups_users.group_id
+) AS holders
+INNER JOIN roles ON roles.id = holders.role_id
+INNER JOIN permissions ON permissions.code IN ('movies:read', 'movies:write', 'users:admin')
+WHERE (roles.name = 'admin')
+OR (roles.name = 'editor' AND permissions.code IN ('movies:read', 'movies:write'))
+OR (roles.name = 'viewer' AND permissions.code = 'movies:read')
+ON CONFLICT DO NOTHING;
+
+DROP TABLE IF EXISTS user_groups_roles;
+DROP TABLE IF EXISTS user_groups_users;
+DROP TABLE IF EXISTS user_groups;
+DROP TABLE IF EXISTS users_roles;
+DROP TABLE IF EXISTS roles_permissions;
+DROP TABLE IF EXISTS roles;
+
+DELETE FROM permissions WHERE code IN ('movies:*', '*');
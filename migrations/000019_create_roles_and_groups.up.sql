@@ -0,0 +1,64 @@
+-- Roles bundle permissions under a name, and can be assigned to users directly or through groups.
+CREATE TABLE IF NOT EXISTS roles (
+  id bigserial PRIMARY KEY,
+  name text UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS roles_permissions (
+  role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+  permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+  PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS users_roles (
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+  PRIMARY KEY (user_id, role_id)
+);
+
+CREATE TABLE IF NOT EXISTS user_groups (
+  id bigserial PRIMARY KEY,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  name text UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_groups_users (
+  group_id bigint NOT NULL REFERENCES user_groups ON DELETE CASCADE,
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS user_groups_users_user_id_idx ON user_groups_users (user_id);
+
+CREATE TABLE IF NOT EXISTS user_groups_roles (
+  group_id bigint NOT NULL REFERENCES user_groups ON DELETE CASCADE,
+  role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+  PRIMARY KEY (group_id, role_id)
+);
+
+-- Wildcard codes grant every permission with the same prefix: "movies:*" grants movies:read and
+-- movies:write, and "*" grants everything.
+INSERT INTO permissions (code) VALUES ('movies:*'), ('*');
+
+INSERT INTO roles (name) VALUES ('viewer'), ('editor'), ('admin');
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE (roles.name, permissions.code) IN (('viewer', 'movies:read'), ('editor', 'movies:*'), ('admin', '*'));
+
+-- Map the existing grants onto roles, giving each user the smallest role covering their permissions.
+INSERT INTO users_roles
+SELECT DISTINCT ON (users_permissions.user_id) users_permissions.user_id, roles.id
+FROM users_permissions
+INNER JOIN permissions ON permissions.id = users_permissions.permission_id
+INNER JOIN roles ON roles.name = CASE permissions.code
+  WHEN 'users:admin' THEN 'admin'
+  WHEN 'movies:write' THEN 'editor'
+  WHEN 'movies:read' THEN 'viewer'
+END
+ORDER BY users_permissions.user_id, CASE roles.name WHEN 'admin' THEN 1 WHEN 'editor' THEN 2 ELSE 3 END;
+
+-- Every direct grant of these codes is now covered by the user's role.
+DELETE FROM users_permissions
+WHERE permission_id IN (SELECT id FROM permissions WHERE code IN ('movies:read', 'movies:write', 'users:admin'));
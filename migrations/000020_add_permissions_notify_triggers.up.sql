@@ -0,0 +1,40 @@
+-- Notify listening API instances when the permissions held by users change, so that they can drop them
+-- from their permission caches. The payload is the ID of the user concerned, or '*' when the change can
+-- concern any number of users.
+CREATE OR REPLACE FUNCTION notify_user_permissions_changed() RETURNS trigger AS $$
+BEGIN
+  IF TG_OP = 'DELETE' THEN
+    PERFORM pg_notify('permissions_changed', OLD.user_id::text);
+  ELSE
+    PERFORM pg_notify('permissions_changed', NEW.user_id::text);
+  END IF;
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION notify_all_permissions_changed() RETURNS trigger AS $$
+BEGIN
+  PERFORM pg_notify('permissions_changed', '*');
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_permissions_notify
+AFTER INSERT OR UPDATE OR DELETE ON users_permissions
+FOR EACH ROW EXECUTE FUNCTION notify_user_permissions_changed();
+
+CREATE TRIGGER users_roles_notify
+AFTER INSERT OR UPDATE OR DELETE ON users_roles
+FOR EACH ROW EXECUTE FUNCTION notify_user_permissions_changed();
+
+CREATE TRIGGER user_groups_users_notify
+AFTER INSERT OR UPDATE OR DELETE ON user_groups_users
+FOR EACH ROW EXECUTE FUNCTION notify_user_permissions_changed();
+
+CREATE TRIGGER user_groups_roles_notify
+AFTER INSERT OR UPDATE OR DELETE ON user_groups_roles
+FOR EACH STATEMENT EXECUTE FUNCTION notify_all_permissions_changed();
+
+CREATE TRIGGER roles_permissions_notify
+AFTER INSERT OR UPDATE OR DELETE ON roles_permissions
+FOR EACH STATEMENT EXECUTE FUNCTION notify_all_permissions_changed();
@@ -0,0 +1,30 @@
+-- Give the editor role its wildcard back, and fold the moderators into it, as editors can moderate again.
+DELETE FROM roles_permissions
+WHERE role_id = (SELECT id FROM roles WHERE name = 'editor');
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name = 'editor' AND permissions.code = 'movies:*';
+
+INSERT INTO users_roles
+SELECT users_roles.user_id, (SELECT id FROM roles WHERE name = 'editor')
+FROM users_roles
+WHERE role_id = (SELECT id FROM roles WHERE name = 'moderator')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO user_groups_roles
+SELECT user_groups_roles.group_id, (SELECT id FROM roles WHERE name = 'editor')
+FROM user_groups_roles
+WHERE role_id = (SELECT id FROM roles WHERE name = 'moderator')
+ON CONFLICT DO NOTHING;
+
+DELETE FROM roles WHERE name = 'moderator';
+
+DELETE FROM permissions WHERE code = 'movies:moderate';
+
+DROP TABLE IF EXISTS movie_collaborators;
+
+DROP INDEX IF EXISTS movies_created_by_idx;
+
+ALTER TABLE movies DROP COLUMN IF EXISTS created_by;
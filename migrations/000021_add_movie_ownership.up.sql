@@ -0,0 +1,34 @@
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS created_by bigint REFERENCES users ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS movies_created_by_idx ON movies (created_by);
+
+-- Collaborators may edit a movie they don't own.
+CREATE TABLE IF NOT EXISTS movie_collaborators (
+  movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+  user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (movie_id, user_id)
+);
+
+-- movies:moderate lets a user edit and delete movies created by other people.
+INSERT INTO permissions (code) VALUES ('movies:moderate');
+
+-- The editor role granted movies:*, which now covers movies:moderate too. Narrow it down to read and
+-- write, so that the existing editors keep editing their own movies and the ones they collaborate on. Movies
+-- created before ownership was recorded have no owner (created_by is NULL), so from now on only moderators
+-- can edit or delete them.
+DELETE FROM roles_permissions
+WHERE role_id = (SELECT id FROM roles WHERE name = 'editor');
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name = 'editor' AND permissions.code IN ('movies:read', 'movies:write');
+
+-- Moderation is granted explicitly, through a new moderator role that administrators assign.
+INSERT INTO roles (name) VALUES ('moderator');
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name = 'moderator' AND permissions.code IN ('movies:read', 'movies:write', 'movies:moderate');
@@ -0,0 +1,11 @@
+-- Invitations let administrators register people when public registration is closed. The invitee
+-- redeems the token emailed to them to create an activated account with the preset permissions.
+CREATE TABLE IF NOT EXISTS invitations (
+  id bigserial PRIMARY KEY,
+  hash bytea UNIQUE NOT NULL,
+  created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  created_by bigint REFERENCES users ON DELETE SET NULL,
+  email citext NOT NULL,
+  permissions text[] NOT NULL DEFAULT '{}',
+  expiry timestamp(0) with time zone NOT NULL
+);
@@ -0,0 +1,20 @@
+-- Record when accounts were first activated, so that accounts which never were can be told apart from
+-- accounts deactivated by an administrator. The activation time of existing accounts isn't known, so
+-- use their creation time.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS activated_at timestamp(0) with time zone;
+
+-- Accounts never activated are purged, so err on the side of keeping accounts: besides the activated ones,
+-- count as activated the accounts an administrator has activated or deactivated, the administrators
+-- themselves, and the accounts which have held any token other than an activation token or an API key.
+UPDATE users SET activated_at = created_at
+WHERE activated_at IS NULL AND (
+  activated
+  OR id IN (SELECT target_user_id FROM audit_events WHERE action IN ('user.activate', 'user.deactivate'))
+  OR id IN (SELECT actor_id FROM audit_events)
+  OR id IN (SELECT user_id FROM tokens WHERE scope <> 'activation')
+  OR id IN (SELECT user_id FROM api_keys)
+);
+
+CREATE INDEX IF NOT EXISTS users_never_activated_idx ON users (created_at) WHERE activated_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS tokens_expiry_idx ON tokens (expiry);
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS users_token_generation_notify ON users;
+
+DROP FUNCTION IF EXISTS notify_user_token_generation_changed();
+
+ALTER TABLE users DROP COLUMN IF EXISTS token_generation;
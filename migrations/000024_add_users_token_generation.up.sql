@@ -0,0 +1,16 @@
+-- Signed authentication tokens carry the token generation of their user when they were issued. Bumping it
+-- revokes every signed token issued before, once the API instances have dropped the user from their
+-- permission caches, so notify them like for permission changes.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS token_generation integer NOT NULL DEFAULT 0;
+
+CREATE OR REPLACE FUNCTION notify_user_token_generation_changed() RETURNS trigger AS $$
+BEGIN
+  PERFORM pg_notify('permissions_changed', NEW.id::text);
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_token_generation_notify
+AFTER UPDATE OF token_generation ON users
+FOR EACH ROW WHEN (OLD.token_generation IS DISTINCT FROM NEW.token_generation)
+EXECUTE FUNCTION notify_user_token_generation_changed();
@@ -0,0 +1,9 @@
+-- Failed logins for addresses without an account are counted like those for accounts, so that locking and
+-- throttling don't reveal which addresses are registered. Rows are removed by the maintenance worker once
+-- their failures would be forgotten anyway.
+CREATE TABLE IF NOT EXISTS unknown_login_failures (
+  email citext PRIMARY KEY,
+  failures integer NOT NULL DEFAULT 0,
+  last_failure_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+  locked_until timestamp(0) with time zone
+);